@@ -6,6 +6,7 @@ package packet
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -82,7 +83,20 @@ func CreateBinaryPacket(header libs.Msi, blob []byte, trace libs.Tracer) ([]byte
 	return buf.Bytes(), nil
 }
 
+// WriteBinary writes the packet; with `write.deadline` configured, the write is limited to writeTimeout.
 func WriteBinary(conn io.Writer, header libs.Msi, blob []byte, trace libs.Tracer) error {
+	ctx := context.Background()
+	if config.Flag("write.deadline") {
+		trace("setting write deadline")
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, writeTimeout)
+		defer cancel()
+	}
+	return WriteBinaryContext(ctx, conn, header, blob, trace)
+}
+
+// WriteBinaryContext writes the packet within the deadline of the context (see iox.WriteAll).
+func WriteBinaryContext(ctx context.Context, conn io.Writer, header libs.Msi, blob []byte, trace libs.Tracer) error {
 	header[headerBlobSize] = len(blob)
 
 	raw, err := CreateBinaryPacket(header, blob, trace)
@@ -98,23 +112,20 @@ func WriteBinary(conn io.Writer, header libs.Msi, blob []byte, trace libs.Tracer
 		}
 	*/
 
-	if config.Flag("write.deadline") {
-		if wd, found := conn.(libs.WriteDeadline); found && wd != nil {
-			trace("setting write deadline")
-			wd.SetWriteDeadline(time.Now().Add(writeTimeout))
-		}
-	}
-
-	return iox.WriteAll(conn, raw, trace)
+	return iox.WriteAllContext(ctx, conn, raw, trace)
 }
 
+// ReadBinaryPacket reads the next packet, waiting for it as long as it takes.
 func ReadBinaryPacket(conn io.Reader, trace libs.Tracer) (*libs.BinaryPacket, error) {
+	return ReadBinaryPacketContext(context.Background(), conn, trace)
+}
+
+// ReadBinaryPacketContext reads the next packet within the deadline of the context (see iox.ReadAll).
+// A stream closed between the packets gives io.EOF, a truncated packet io.ErrUnexpectedEOF.
+func ReadBinaryPacketContext(ctx context.Context, conn io.Reader, trace libs.Tracer) (*libs.BinaryPacket, error) {
 	prefix := make([]byte, binaryPacketPrefixSize)
-	size, err := conn.Read(prefix)
-	if err != nil {
+	if err := iox.ReadAllContext(ctx, conn, prefix, trace); err != nil {
 		return nil, err
-	} else if size != binaryPacketPrefixSize {
-		return nil, errSignature
 	}
 
 	var (
@@ -143,12 +154,9 @@ func ReadBinaryPacket(conn io.Reader, trace libs.Tracer) (*libs.BinaryPacket, er
 	}
 
 	headerBuf := make([]byte, headerSize)
-	size, err = conn.Read(headerBuf)
-	if err != nil {
-		return nil, err
-	} else if size != int(headerSize) {
-		trace("invalid header size: %v vs %v", size, int(headerSize))
-		return nil, errSignature
+	if err := iox.ReadAllContext(ctx, conn, headerBuf, trace); err != nil {
+		trace("failed to read header: %v", err)
+		return nil, truncated(err)
 	}
 
 	var header libs.Msi
@@ -174,12 +182,20 @@ func ReadBinaryPacket(conn io.Reader, trace libs.Tracer) (*libs.BinaryPacket, er
 
 	if blobSize > 0 {
 		blob := make([]byte, blobSize)
-		if err := iox.ReadAll(conn, blob, trace); err != nil {
+		if err := iox.ReadAllContext(ctx, conn, blob, trace); err != nil {
 			trace("failed to read blob: %v", err)
-			return nil, errSignature
+			return nil, truncated(err)
 		}
 		bp.Blob = blob
 	}
 
 	return bp, nil
 }
+
+// truncated reports the end of the stream in the middle of a packet as such.
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// configcheck validates config files against a schema and prints all the problems found.
+//
+//	configcheck [-schema schema.json] [-env production] config [config...]
+//
+// Without -schema, the schema named by the `config.schema` key of each file is used.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/seamia/libs/config"
+)
+
+func main() {
+	schemaName := flag.String("schema", "", "schema file (defaults to the config.schema key of the config)")
+	environment := flag.String("env", "", "environment overlay to check (overrides ENV)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] config [config...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var schema *config.Schema
+	if len(*schemaName) > 0 {
+		var err error
+		if schema, err = config.LoadSchema(*schemaName); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *schemaName, err)
+			os.Exit(2)
+		}
+	}
+	if len(*environment) > 0 {
+		os.Setenv("ENV", *environment)
+	}
+
+	failed := false
+	for _, name := range flag.Args() {
+		err := config.Check(name, schema)
+		if err == nil {
+			fmt.Printf("%s: ok\n", name)
+			continue
+		}
+
+		failed = true
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			for _, problem := range invalid.Problems {
+				fmt.Printf("%s: %s\n", name, problem)
+			}
+		} else {
+			fmt.Printf("%s: %v\n", name, err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seamia/libs"
+)
+
+const (
+	bindTag       = "config"
+	optRequired   = "required"
+	optDefaultKey = "default="
+)
+
+var (
+	typeDuration = reflect.TypeOf(time.Duration(0))
+	typeTime     = reflect.TypeOf(time.Time{})
+)
+
+// BindError lists all the problems found while binding a struct.
+type BindError struct {
+	Missing  []string // required keys with no value
+	Problems []string // values that could not be converted
+}
+
+func (e *BindError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing required keys: "+strings.Join(e.Missing, ", "))
+	}
+	parts = append(parts, e.Problems...)
+	return "config: " + strings.Join(parts, "; ")
+}
+
+// Bind populates the fields of the struct pointed to by target from the store.
+// Fields are selected with tags of the form `config:"db.host,required,default=localhost"`,
+// where `default=` (if present) must be the last option, so the default may contain commas.
+// Untagged nested structs are walked as well. Supported field types are strings,
+// ints, uints, floats, bools, time.Duration, time.Time and slices of those
+// (given as comma separated lists).
+func (s *Store) Bind(target any) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Bind requires a non-nil pointer to a struct")
+	}
+
+	problems := &BindError{}
+	s.bindStruct(value.Elem(), problems)
+	if len(problems.Missing) > 0 || len(problems.Problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// BindLive binds the target and keeps binding it again after every reload that
+// changed anything. A reload that fails to bind leaves the target intact.
+// The (optional) locker is held while the target is being updated.
+func (s *Store) BindLive(target any, locker sync.Locker) error {
+	if err := s.Bind(target); err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	s.Subscribe(func(Diff) {
+		// bound over a copy: the untagged fields and the absent optional keys keep their values
+		fresh := reflect.New(value.Type())
+		if locker != nil {
+			locker.Lock()
+		}
+		fresh.Elem().Set(value)
+		if locker != nil {
+			locker.Unlock()
+		}
+		if err := s.Bind(fresh.Interface()); err != nil {
+			libs.Warning("config: failed to re-bind %v after reload: %v", value.Type(), err)
+			return
+		}
+		if locker != nil {
+			locker.Lock()
+			defer locker.Unlock()
+		}
+		value.Set(fresh.Elem())
+	})
+	return nil
+}
+
+func (s *Store) bindStruct(value reflect.Value, problems *BindError) {
+	kind := value.Type()
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, tagged := field.Tag.Lookup(bindTag)
+		if !tagged {
+			if field.Type.Kind() == reflect.Struct && field.Type != typeTime {
+				s.bindStruct(value.Field(i), problems)
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+
+		key, required, fallback, hasFallback := parseBindTag(tag, field.Name)
+		txt, found := s.Lookup(key)
+		if !found || len(txt) == 0 {
+			if hasFallback {
+				txt = fallback
+			} else if required {
+				problems.Missing = append(problems.Missing, key)
+				continue
+			} else {
+				continue
+			}
+		}
+
+		if err := assign(value.Field(i), txt); err != nil {
+			if s.load().secret[key] {
+				err = errors.New("invalid value " + redacted)
+			}
+			problems.Problems = append(problems.Problems, fmt.Sprintf("key (%s): %v", key, err))
+		}
+	}
+}
+
+func parseBindTag(tag, fieldName string) (key string, required bool, fallback string, hasFallback bool) {
+	if at := strings.Index(tag, optDefaultKey); at >= 0 && (at == 0 || tag[at-1] == ',') {
+		fallback, hasFallback = tag[at+len(optDefaultKey):], true
+		tag = strings.TrimSuffix(tag[:at], ",")
+	}
+
+	options := strings.Split(tag, ",")
+	key = strings.TrimSpace(options[0])
+	if len(key) == 0 {
+		key = fieldName
+	}
+	for _, option := range options[1:] {
+		if strings.TrimSpace(option) == optRequired {
+			required = true
+		}
+	}
+	return
+}
+
+func assign(field reflect.Value, txt string) error {
+	switch field.Type() {
+	case typeDuration:
+		value, err := time.ParseDuration(txt)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(value))
+		return nil
+	case typeTime:
+		value, err := parseTime(txt)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(txt)
+	case reflect.Bool:
+		value, found := parseBool(txt)
+		if !found {
+			return fmt.Errorf("invalid bool value (%s)", txt)
+		}
+		field.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(txt, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(txt, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(txt, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(value)
+	case reflect.Slice:
+		items := splitList(txt)
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+	default:
+		return fmt.Errorf("unsupported field type (%v)", field.Type())
+	}
+	return nil
+}
+
+// Bind populates the target struct from the default store.
+func Bind(target any) error {
+	return Default().Bind(target)
+}
+
+// BindLive binds the target struct to the default store and keeps it updated on reload.
+func BindLive(target any, locker sync.Locker) error {
+	return Default().BindLive(target, locker)
+}
@@ -0,0 +1,597 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seamia/libs"
+)
+
+func TestStoreSources(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(name, []byte(`{"a": "1", "b": "yes"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	defer fromFile.Close()
+	fromReader, err := Read(strings.NewReader(`{"a": "1", "b": "yes"}`))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	fromMap := New(Config{"a": "1", "b": "yes"})
+
+	for _, store := range []*Store{fromFile, fromReader, fromMap} {
+		if got := store.GetInt("a", 0); got != 1 {
+			t.Errorf("GetInt(a) = %d, want 1", got)
+		}
+		if !store.Flag("b") {
+			t.Errorf("Flag(b) = false, want true")
+		}
+		if got := store.Get("missing"); got != "" {
+			t.Errorf("Get(missing) = %q, want empty", got)
+		}
+	}
+}
+
+func TestLiveReload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config.json")
+	write := func(port string) {
+		if err := os.WriteFile(name, []byte(`{"live.reload": "yes", "port": "`+port+`"}`), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1")
+	store, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// written until noticed: the watcher is set up in the background
+	for deadline := time.Now().Add(10 * time.Second); store.Get("port") != "2"; time.Sleep(200 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the change was not reloaded")
+		}
+		write("2")
+	}
+
+	// a closed store no longer follows the file
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write("3")
+	time.Sleep(1500 * time.Millisecond)
+	if got := store.Get("port"); got != "2" {
+		t.Errorf("port = %s after Close, want 2", got)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "absent")); err == nil {
+		t.Errorf("Load of a missing file did not fail")
+	}
+	if _, err := Read(strings.NewReader(`{not json`)); err == nil {
+		t.Errorf("Read of malformed input did not fail")
+	}
+}
+
+func TestDefaultStore(t *testing.T) {
+	SetDefault(New(Config{"x": "42", "debug": "yes"}))
+	defer SetDefault(nil)
+
+	if got := GetInt("x", 0); got != 42 {
+		t.Errorf("GetInt(x) = %d, want 42", got)
+	}
+	if !Debug() {
+		t.Errorf("Debug() = false, want true")
+	}
+}
+
+func TestReloadNotifies(t *testing.T) {
+	store := New(Config{"a": "1", "b": "2"})
+
+	var watched []string
+	store.Watch("a", func(old, new string) {
+		watched = append(watched, old+"->"+new)
+	})
+	var diffs []Diff
+	store.Subscribe(func(diff Diff) {
+		diffs = append(diffs, diff)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			store.Get("a")
+		}
+	}()
+	store.replace(mustSnapshot(t, Config{"a": "3", "c": "4"}))
+	<-done
+
+	if len(watched) != 1 || watched[0] != "1->3" {
+		t.Errorf("watch calls = %v, want [1->3]", watched)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("got %d diffs, want 1", len(diffs))
+	}
+	diff := diffs[0]
+	if diff.Changed["a"] != (Change{Old: "1", New: "3"}) || diff.Removed["b"] != "2" || diff.Added["c"] != "4" {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+
+	store.replace(mustSnapshot(t, Config{"a": "3", "c": "4"}))
+	if len(diffs) != 1 {
+		t.Errorf("subscribers notified about an empty diff")
+	}
+}
+
+func TestTypedGetters(t *testing.T) {
+	store := New(Config{
+		"timeout": "1m30s",
+		"ratio":   "0.25",
+		"enabled": "On",
+		"hosts":   " a, b ,,c ",
+		"buffer":  "16MiB",
+		"chunk":   "1.5k",
+		"start":   "2024-05-01",
+		"broken":  "nope",
+	})
+
+	if got := store.GetDuration("timeout", 0); got != 90*time.Second {
+		t.Errorf("GetDuration = %v", got)
+	}
+	if got := store.GetDuration("broken", time.Second); got != time.Second {
+		t.Errorf("GetDuration fallback = %v", got)
+	}
+	if got := store.GetFloat("ratio", 0); got != 0.25 {
+		t.Errorf("GetFloat = %v", got)
+	}
+	if !store.GetBool("enabled", false) || !store.GetBool("missing", true) || store.GetBool("broken", false) {
+		t.Errorf("GetBool misbehaves")
+	}
+	if got := store.GetList("hosts", nil); strings.Join(got, "|") != "a|b|c" {
+		t.Errorf("GetList = %q", got)
+	}
+	if got := store.GetSize("buffer", 0); got != 16<<20 {
+		t.Errorf("GetSize(buffer) = %d", got)
+	}
+	if got := store.GetSize("chunk", 0); got != 1536 {
+		t.Errorf("GetSize(chunk) = %d", got)
+	}
+	if got := store.GetSize("broken", 7); got != 7 {
+		t.Errorf("GetSize fallback = %d", got)
+	}
+	if _, err := parseSize("9223372036854775807"); err == nil {
+		t.Errorf("parseSize accepted a size that overflows int64")
+	}
+	if got := store.GetTime("start", time.Time{}); !got.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("GetTime = %v", got)
+	}
+}
+
+func TestBind(t *testing.T) {
+	type settings struct {
+		Host    string        `config:"db.host,default=localhost"`
+		Port    int           `config:"db.port,required"`
+		User    string        `config:"db.user,required"`
+		Timeout time.Duration `config:"db.timeout,default=5s"`
+		Tags    []string      `config:"tags,default=a,b"`
+		Nested  struct {
+			Verbose bool `config:"verbose"`
+		}
+	}
+
+	var s settings
+	err := New(Config{"verbose": "on"}).Bind(&s)
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || strings.Join(bindErr.Missing, ",") != "db.port,db.user" {
+		t.Fatalf("Bind error = %v, want both required keys reported", err)
+	}
+
+	store := New(Config{"db.port": "5432", "db.user": "app", "verbose": "on"})
+	if err := store.Bind(&s); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if s.Host != "localhost" || s.Port != 5432 || s.User != "app" || s.Timeout != 5*time.Second ||
+		strings.Join(s.Tags, "|") != "a|b" || !s.Nested.Verbose {
+		t.Errorf("unexpected binding: %+v", s)
+	}
+
+	if err := New(Config{"db.port": "many", "db.user": "app"}).Bind(&s); err == nil {
+		t.Errorf("Bind accepted a non-numeric port")
+	}
+}
+
+func TestBindLive(t *testing.T) {
+	var s struct {
+		Port    int    `config:"port"`
+		Host    string `config:"db.host"`
+		Timeout int    `config:"timeout"`
+		Handler string
+	}
+	s.Timeout, s.Handler = 30, "h"
+	store := New(Config{"port": "1", "db.host": "a"})
+	if err := store.BindLive(&s, nil); err != nil {
+		t.Fatal(err)
+	}
+	store.replace(mustSnapshot(t, Config{"port": "2", "db.host": "b"}))
+	if s.Port != 2 || s.Host != "b" {
+		t.Errorf("Port, Host = %d, %s after reload, want 2, b", s.Port, s.Host)
+	}
+	if s.Timeout != 30 || s.Handler != "h" {
+		t.Errorf("Timeout, Handler = %d, %q after reload, want them untouched", s.Timeout, s.Handler)
+	}
+	store.replace(mustSnapshot(t, Config{"port": "bad"}))
+	if s.Port != 2 {
+		t.Errorf("Port = %d after a bad reload, want 2", s.Port)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(name, []byte(`{"a": "file", "b": "file", "c": "file"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := &Loader{
+		Defaults:  Config{"a": "default", "d": "default"},
+		File:      name,
+		EnvPrefix: "APP_",
+		Environ:   []string{"APP_B=env", "APP_C=env", "APP_MAX__CONN=7", "OTHER=x"},
+		Args:      []string{"run", "--c=flag", "--verbose"},
+	}
+	store, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	expected := map[string][2]string{
+		"a":        {"file", "file (" + name + ")"},
+		"b":        {"env", "env (APP_B)"},
+		"c":        {"flag", "flag (--c)"},
+		"d":        {"default", "default"},
+		"max_conn": {"7", "env (APP_MAX__CONN)"},
+		"verbose":  {"yes", "flag (--verbose)"},
+	}
+	for key, want := range expected {
+		if got := store.Get(key); got != want[0] {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want[0])
+		}
+		if got := store.Source(key); got != want[1] {
+			t.Errorf("Source(%s) = %q, want %q", key, got, want[1])
+		}
+	}
+	if got := store.Source("missing"); got != "" {
+		t.Errorf("Source(missing) = %q, want empty", got)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	sources := map[string]string{
+		"app.yaml": `
+# comment
+db:
+  host: localhost   # inline comment
+  port: 5432
+  replicas:
+  - one
+  - "two"
+name: 'app'
+tags: [a, b]
+hosts:
+  - localhost:8080
+  - http://example.com/
+motd: |
+  hello
+  world
+`,
+		"app.ini": `
+; comment
+name = app
+tags = ["a", "b"]
+[db]
+host = localhost
+port: 5432
+replicas = one,two
+`,
+		"app.env": `
+# comment
+export NAME=app
+DB_HOST="localhost"
+DB_PORT=5432 # inline comment
+DB_REPLICAS=one,two
+TAGS=a,b
+`,
+		"app.jsonc": `{
+	// comment
+	"name": "app", /* another one */
+	"db": {"host": "localhost", "port": 5432, "replicas": ["one", "two"]},
+	"tags": ["a", "b"],
+}`,
+	}
+
+	for name, content := range sources {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		store, err := Load(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		defer store.Close()
+		for key, want := range map[string]string{
+			"name": "app", "db.host": "localhost", "db.port": "5432", "db.replicas": "one,two", "tags": "a,b",
+		} {
+			if got := store.Get(key); got != want {
+				t.Errorf("%s: Get(%s) = %q, want %q", name, key, got, want)
+			}
+		}
+		if name == "app.yaml" && store.Get("motd") != "hello\nworld" {
+			t.Errorf("%s: block scalar = %q", name, store.Get("motd"))
+		}
+		if name == "app.yaml" && store.Get("hosts") != "localhost:8080,http://example.com/" {
+			t.Errorf("%s: list of host:port = %q", name, store.Get("hosts"))
+		}
+	}
+
+	// lists of maps are still refused
+	maps := filepath.Join(t.TempDir(), "maps.yaml")
+	os.WriteFile(maps, []byte("items:\n  - name: x\n"), 0666)
+	if _, err := Load(maps); err == nil {
+		t.Errorf("a list of maps was accepted")
+	}
+
+	// without an extension the format is detected from the content
+	store, err := Read(strings.NewReader("db:\n  host: example\n"))
+	if err != nil || store.Get("db.host") != "example" {
+		t.Errorf("yaml detection failed: %v", err)
+	}
+	for content, want := range map[string][2]string{
+		"max_conn=5\n[db]\nhost=example\n": {"max_conn", "5"},
+		"export max_conn=5\n":              {"max.conn", "5"},
+		"MAX_CONN=5\n":                     {"max.conn", "5"},
+	} {
+		store, err := Read(strings.NewReader(content))
+		if err != nil {
+			t.Errorf("%q: %v", content, err)
+		} else if got := store.Get(want[0]); got != want[1] {
+			t.Errorf("%q: Get(%s) = %q, want %q", content, want[0], got, want[1])
+		}
+	}
+}
+
+func TestIncludeAndOverlay(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common/base.yaml":  "db:\n  host: base\n  port: 1\nname: base\n",
+		"common/extra.json": `{"extra": "yes", "name": "extra"}`,
+		"config":            `{"include": ["common/base.yaml", "common/extra.json"], "db.port": "2", "config.env": "staging"}`,
+		"config.staging":    `{"db.host": "staging"}`,
+		"config.production": `{"db.host": "production"}`,
+		"loop/a.json":       `{"include": "b.json"}`,
+		"loop/b.json":       `{"include": "a.json"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv(envEnvironment, "")
+	store, err := Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for key, want := range map[string]string{"db.host": "staging", "db.port": "2", "name": "extra", "extra": "yes", "include": ""} {
+		if got := store.Get(key); got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if got, want := store.Source("db.port"), "file ("+filepath.Join(dir, "config")+")"; got != want {
+		t.Errorf("Source(db.port) = %q, want %q", got, want)
+	}
+	if got := len(store.load().files); got != 4 {
+		t.Errorf("read %d files, want 4", got)
+	}
+
+	t.Setenv(envEnvironment, "production")
+	if store, err = Load(filepath.Join(dir, "config")); err != nil || store.Get("db.host") != "production" {
+		t.Errorf("ENV overlay not applied: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := Load(filepath.Join(dir, "loop/a.json")); err == nil {
+		t.Errorf("circular include was not detected")
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db_pw"), []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 32)
+	sealed, err := Seal(map[string]string{"api": "s3cr3t"}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealedName := filepath.Join(dir, "secrets.sealed")
+	if err := os.WriteFile(sealedName, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewSealedFile(sealedName, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSecretProvider(provider)
+	defer SetSecretProvider(SecretDir(defaultSecretsDir))
+
+	var logged []string
+	libs.Trace = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	defer func() { libs.Trace = func(string, ...interface{}) {} }()
+
+	store := New(Config{
+		"debug":   "yes",
+		"$pw":     "${file:" + filepath.Join(dir, "db_pw") + "}",
+		"db.pw":   "${pw}",
+		"api.key": "key=${secret:api}",
+		"plain":   "${pw2}",
+	})
+	if got := store.Get("db.pw"); got != "hunter2" {
+		t.Errorf("file reference = %q", got)
+	}
+	if got := store.Get("api.key"); got != "key=s3cr3t" {
+		t.Errorf("secret reference = %q", got)
+	}
+
+	store.replace(mustSnapshot(t, Config{"debug": "yes", "db.pw": "${file:" + filepath.Join(dir, "db_pw") + "}", "api.key": "other"}))
+	if len(logged) == 0 {
+		t.Errorf("nothing was traced")
+	}
+	for _, line := range logged {
+		if strings.Contains(line, "hunter2") || strings.Contains(line, "s3cr3t") {
+			t.Errorf("secret leaked into the log: %s", line)
+		}
+	}
+
+	if _, err := SecretDir(dir).Secret("../etc/passwd"); err == nil {
+		t.Errorf("SecretDir accepted a path")
+	}
+	if _, err := Unseal(sealed, make([]byte, 32)); err != nil {
+		t.Errorf("Unseal: %v", err)
+	}
+	wrong := make([]byte, 32)
+	wrong[0] = 1
+	if _, err := Unseal(sealed, wrong); err == nil {
+		t.Errorf("Unseal accepted a wrong key")
+	}
+}
+
+func mustSnapshot(t *testing.T, data Config) *snapshot {
+	t.Helper()
+	snap, err := newSnapshot(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap
+}
+
+func TestExpansion(t *testing.T) {
+	t.Setenv("CONFIG_TEST_HOME", "/home/app")
+
+	store, err := NewStrict(Config{
+		"$root":  "${CONFIG_TEST_HOME}/data",
+		"$logs":  "$root/logs",
+		"dir":    "${logs}",
+		"port":   "${PORT_NOT_SET:-80${suffix:-80}}",
+		"price":  "$$5",
+		"nested": "${missing:-${root}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"dir":    "/home/app/data/logs",
+		"$logs":  "/home/app/data/logs",
+		"port":   "8080",
+		"price":  "$5",
+		"nested": "/home/app/data",
+	} {
+		if got := store.Get(key); got != want {
+			t.Errorf("Get(%s) = %q, want %q", key, got, want)
+		}
+	}
+
+	if _, err := NewStrict(Config{"$a": "$b", "$b": "${a}", "x": "$a"}); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("cycle not detected: %v", err)
+	}
+	if _, err := NewStrict(Config{"x": "${undefined_key}"}); err == nil {
+		t.Errorf("strict mode accepted an unresolved reference")
+	}
+	if got := New(Config{"x": "a${undefined_key}b"}).Get("x"); got != "a${undefined_key}b" {
+		t.Errorf("non-strict miss = %q", got)
+	}
+	if _, err := NewStrict(Config{"x": "${undefined_key:?set the key}"}); err == nil || !strings.Contains(err.Error(), "set the key") {
+		t.Errorf(":? did not fail with the message: %v", err)
+	}
+	if _, err := Read(strings.NewReader(`{"config.strict": "yes", "x": "$nope"}`)); err == nil {
+		t.Errorf("config.strict key ignored")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := ParseSchema([]byte(`{
+		// comments are allowed
+		"strict": true,
+		"keys": {
+			"db.host": {"required": true, "aliases": ["db.hostname"]},
+			"db.port": {"type": "int", "required": true},
+			"mode":    {"allowed": ["dev", "prod"]},
+			"name":    {"pattern": "^[a-z]+$"},
+			"timeout": {"type": "duration"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(good, []byte(`{"db.hostname": "old", "db.port": "1", "mode": "dev", "debug": "no"}`), 0666)
+	os.WriteFile(bad, []byte(`{"db.prot": "x", "mode": "test", "name": "Upper", "timeout": "soon"}`), 0666)
+
+	if err := Check(good, schema); err != nil {
+		t.Errorf("Check(good): %v", err)
+	}
+
+	var invalid *ValidationError
+	if err := Check(bad, schema); !errors.As(err, &invalid) {
+		t.Fatalf("Check(bad) = %v, want a ValidationError", err)
+	}
+	joined := strings.Join(invalid.Problems, "\n")
+	for _, expected := range []string{"(db.host) is required", "(db.port) is required", "(db.prot) is unknown (did you mean db.port?)", "(mode)", "(name)", "(timeout)"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("missing problem %q in:\n%s", expected, joined)
+		}
+	}
+
+	// the schema is picked up from the config itself and aliases are renamed
+	os.WriteFile(filepath.Join(dir, "schema.json"), []byte(`{"keys": {"db.host": {"required": true, "aliases": ["db.hostname"]}}}`), 0666)
+	os.WriteFile(good, []byte(`{"config.schema": "schema.json", "db.hostname": "old"}`), 0666)
+	store, err := Load(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got := store.Get("db.host"); got != "old" {
+		t.Errorf("alias not applied: %q", got)
+	}
+
+	// an invalid reload keeps the old data
+	os.WriteFile(good, []byte(`{"config.schema": "schema.json"}`), 0666)
+	if fresh, err := store.refresh(); err == nil {
+		t.Errorf("invalid reload accepted: %v", fresh.data)
+	}
+}
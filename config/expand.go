@@ -0,0 +1,239 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/seamia/libs"
+)
+
+const (
+	keyStrict          = "config.strict" // "yes" turns unresolved references into load errors
+	maxExpansionDepth  = 64
+	operatorDefault    = ":-" // ${key:-default} - the default is used when key is missing or empty
+	operatorRequired   = ":?" // ${key:?message} - fails the load when key is missing or empty
+	variablePrefix     = "$"
+	variableBraceOpen  = '{'
+	variableBraceClose = '}'
+)
+
+// expander resolves `$name` and `${name}` references in config values.
+// A reference is looked up as a `file:`/`secret:` reference, then as a `$name` key
+// in the config itself (expanded recursively) and finally as an environment variable.
+// `$$` stands for a literal `$`.
+type expander struct {
+	data   Config
+	strict bool
+
+	done      map[string]string // already expanded `$` keys
+	sensitive map[string]bool   // keys whose values contain secrets
+	chain     []string          // `$` keys being expanded (cycle detection)
+}
+
+func newExpander(data Config, strict bool) *expander {
+	return &expander{
+		data:      data,
+		strict:    strict,
+		done:      make(map[string]string),
+		sensitive: make(map[string]bool),
+	}
+}
+
+// expand replaces all the references in the text; it reports whether any of them was a secret.
+func (e *expander) expand(text string) (string, bool, error) {
+	if !strings.Contains(text, variablePrefix) {
+		return text, false, nil
+	}
+
+	var out strings.Builder
+	sensitive := false
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || i+1 == len(text) {
+			out.WriteByte(text[i])
+			continue
+		}
+
+		var name, operator, argument, raw string
+		switch next := text[i+1]; {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+			continue
+
+		case next == variableBraceOpen:
+			end := matchingBrace(text, i+1)
+			if end < 0 {
+				return "", false, fmt.Errorf("config: unterminated reference in (%s)", text)
+			}
+			raw = text[i : end+1]
+			name, operator, argument = splitOperator(text[i+2 : end])
+			i = end
+
+		case isNameChar(next):
+			end := i + 1
+			for end < len(text) && isNameChar(text[end]) {
+				end++
+			}
+			raw = text[i:end]
+			name = text[i+1 : end]
+			i = end - 1
+
+		default:
+			out.WriteByte('$')
+			continue
+		}
+
+		value, found, secret, err := e.resolve(name)
+		if err != nil {
+			return "", false, err
+		}
+
+		if (!found || len(value) == 0) && len(operator) > 0 {
+			switch operator {
+			case operatorDefault:
+				if value, secret, err = e.expand(argument); err != nil {
+					return "", false, err
+				}
+				found = true
+			case operatorRequired:
+				message := argument
+				if len(message) == 0 {
+					message = "is required"
+				}
+				return "", false, fmt.Errorf("config: %s: %s", name, message)
+			}
+		}
+
+		if !found {
+			if e.strict {
+				return "", false, fmt.Errorf("config: unresolved reference (%s)", raw)
+			}
+			libs.Warning("config: unresolved reference (%s) - leaving it intact", raw)
+			value = raw
+		}
+
+		sensitive = sensitive || secret
+		out.WriteString(value)
+	}
+	return out.String(), sensitive, nil
+}
+
+// resolve looks the name up; a failure to read a referenced secret is an error only in strict mode.
+func (e *expander) resolve(name string) (value string, found, secret bool, err error) {
+	// 1. see if this is a reference to a secret
+	if value, found, err := resolveReference(name); found {
+		if err != nil {
+			if e.strict {
+				return "", false, false, err
+			}
+			libs.Warning("config: failed to resolve reference (%s): %v", name, err)
+			return "", false, false, nil
+		}
+		return value, true, true, nil
+	}
+
+	// 2. see if we have the key in data
+	if _, found := e.data[variablePrefix+name]; found {
+		value, err := e.variable(variablePrefix + name)
+		return value, true, e.sensitive[variablePrefix+name], err
+	}
+
+	// 3. see if there is such an env var
+	if value, found := os.LookupEnv(name); found {
+		return value, true, false, nil
+	}
+
+	return "", false, false, nil
+}
+
+// variable returns the fully expanded value of a `$` key.
+func (e *expander) variable(key string) (string, error) {
+	if value, found := e.done[key]; found {
+		return value, nil
+	}
+
+	for at, visited := range e.chain {
+		if visited == key {
+			return "", fmt.Errorf("config: circular reference: %s -> %s", strings.Join(e.chain[at:], " -> "), key)
+		}
+	}
+	if len(e.chain) >= maxExpansionDepth {
+		return "", fmt.Errorf("config: expansion of (%s) is too deep", key)
+	}
+
+	e.chain = append(e.chain, key)
+	value, secret, err := e.expand(e.data[key])
+	e.chain = e.chain[:len(e.chain)-1]
+	if err != nil {
+		return "", err
+	}
+
+	e.done[key] = value
+	e.sensitive[key] = secret
+	return value, nil
+}
+
+func matchingBrace(text string, open int) int {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case variableBraceOpen:
+			depth++
+		case variableBraceClose:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func splitOperator(inner string) (name, operator, argument string) {
+	for _, op := range []string{operatorDefault, operatorRequired} {
+		if at := strings.Index(inner, op); at >= 0 {
+			return inner[:at], op, inner[at+len(op):]
+		}
+	}
+	return inner, "", ""
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// expand resolves the references in all the values of the snapshot.
+func (s *snapshot) expand(strict bool) error {
+	e := newExpander(s.data, strict)
+	s.secret = make(map[string]bool)
+
+	expanded := make(Config, len(s.data))
+	for key, value := range s.data {
+		var err error
+		var sensitive bool
+		if strings.HasPrefix(key, variablePrefix) {
+			value, err = e.variable(key)
+			sensitive = e.sensitive[key]
+		} else {
+			var result string
+			if result, sensitive, err = e.expand(value); err == nil && result != value {
+				if s.debug {
+					libs.Trace("config: changing (%s) to (%s)", value, displayValue(sensitive, result))
+				}
+				value = result
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%w (while expanding key %s)", err, key)
+		}
+		expanded[key] = value
+		s.secret[key] = sensitive
+	}
+
+	s.data = expanded
+	return nil
+}
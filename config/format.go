@@ -0,0 +1,506 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// supported config file formats; nested sections are flattened into dotted keys
+const (
+	formatJson = "json" // also accepts // and /* */ comments and trailing commas (jsonc)
+	formatYaml = "yaml" // block mappings, lists of scalars, flow lists and block scalars
+	formatIni  = "ini"  // [section] key = value; also covers the simple subset of toml
+	formatEnv  = "env"  // KEY=value, keys are mapped the same way as APP_ environment variables
+)
+
+var (
+	formatByExtension = map[string]string{
+		".json":  formatJson,
+		".jsonc": formatJson,
+		".yaml":  formatYaml,
+		".yml":   formatYaml,
+		".ini":   formatIni,
+		".toml":  formatIni,
+		".cfg":   formatIni,
+		".env":   formatEnv,
+	}
+
+	// without an `export`, only an upper-case key tells an .env file from an ini one (max_conn=5)
+	envLine  = regexp.MustCompile(`^(export\s+[A-Za-z_][A-Za-z0-9_]*|[A-Z_][A-Z0-9_]*)=`)
+	yamlLine = regexp.MustCompile(`^\s*[^\s#=\[{][^=]*?:(\s|$)`)
+)
+
+// detectFormat picks the format by the name's extension, falling back to sniffing the content.
+func detectFormat(name string, raw []byte) string {
+	if format, found := formatByExtension[strings.ToLower(filepath.Ext(name))]; found {
+		return format
+	}
+	if base := filepath.Base(name); base == ".env" || strings.HasPrefix(base, ".env.") {
+		return formatEnv
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) == 0, strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"), line == "---":
+			continue
+		case strings.HasPrefix(line, "{"), strings.HasPrefix(line, "//"), strings.HasPrefix(line, "/*"):
+			return formatJson
+		case strings.HasPrefix(line, "["):
+			return formatIni
+		case envLine.MatchString(line):
+			return formatEnv
+		case yamlLine.MatchString(line), strings.HasPrefix(line, "- "):
+			return formatYaml
+		default:
+			return formatIni
+		}
+	}
+	return formatJson
+}
+
+// decodeAs parses the raw content of the named file (the name is used only to detect the format).
+func decodeAs(name string, raw []byte) (Config, error) {
+	var data Config
+	var err error
+	switch detectFormat(name, raw) {
+	case formatYaml:
+		data, err = decodeYaml(raw)
+	case formatIni:
+		data, err = decodeIni(raw)
+	case formatEnv:
+		data, err = decodeEnv(raw)
+	default:
+		data, err = decodeJson(raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(Config)
+	}
+	return data, nil
+}
+
+func decodeJson(raw []byte) (Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(stripJsonComments(raw)))
+	decoder.UseNumber()
+
+	var payload any
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return make(Config), nil
+	}
+	if _, isMap := payload.(map[string]any); !isMap {
+		return nil, fmt.Errorf("config: expected a json object, got %T", payload)
+	}
+
+	data := make(Config)
+	flattenJson("", payload, data)
+	return data, nil
+}
+
+func flattenJson(prefix string, payload any, data Config) {
+	switch actual := payload.(type) {
+	case map[string]any:
+		for key, value := range actual {
+			flattenJson(prefix+key+".", value, data)
+		}
+	case []any:
+		key := strings.TrimSuffix(prefix, ".")
+		var items []string
+		for i, value := range actual {
+			switch value.(type) {
+			case map[string]any, []any:
+				flattenJson(prefix+strconv.Itoa(i)+".", value, data)
+			default:
+				items = append(items, jsonScalar(value))
+			}
+		}
+		if len(items) > 0 || len(actual) == 0 {
+			data[key] = strings.Join(items, ",")
+		}
+	default:
+		data[strings.TrimSuffix(prefix, ".")] = jsonScalar(actual)
+	}
+}
+
+func jsonScalar(value any) string {
+	switch actual := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return actual
+	case json.Number:
+		return actual.String()
+	case bool:
+		return strconv.FormatBool(actual)
+	default:
+		return fmt.Sprint(actual)
+	}
+}
+
+// stripJsonComments removes // and /* */ comments (outside of strings) and trailing commas.
+func stripJsonComments(raw []byte) []byte {
+	var out bytes.Buffer
+	inString, escaped := false, false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if inString {
+			out.WriteByte(c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(raw) && raw[i+1] == '/':
+			for i < len(raw) && raw[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(raw) && raw[i+1] == '*':
+			end := bytes.Index(raw[i+2:], []byte("*/"))
+			if end < 0 {
+				return out.Bytes()
+			}
+			i += end + 3
+			out.WriteByte(' ')
+		case c == ',':
+			// drop the comma if the next meaningful character closes the object/array
+			j := i + 1
+			for j < len(raw) && (raw[j] == ' ' || raw[j] == '\t' || raw[j] == '\r' || raw[j] == '\n') {
+				j++
+			}
+			if j >= len(raw) || (raw[j] != '}' && raw[j] != ']') {
+				out.WriteByte(c)
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// stripComment removes a trailing comment that starts with one of the markers
+// (at the start of the line or after a white space) outside of quotes.
+func stripComment(line string, markers string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.IndexByte(markers, c) >= 0 && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
+
+// unquote removes the surrounding quotes of a scalar value (if any).
+func unquote(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return value, nil
+	}
+	switch value[0] {
+	case '"':
+		return strconv.Unquote(value)
+	case '\'':
+		if value[len(value)-1] != '\'' {
+			return "", fmt.Errorf("unterminated quote in (%s)", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// splitFlow splits the inside of a flow list "[a, 'b', c]" into unquoted items.
+func splitFlow(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("malformed list (%s)", value)
+	}
+	value = value[1 : len(value)-1]
+
+	var items []string
+	var quote byte
+	start := 0
+	add := func(end int) error {
+		if item := strings.TrimSpace(value[start:end]); len(item) > 0 {
+			unquoted, err := unquote(item)
+			if err != nil {
+				return err
+			}
+			items = append(items, unquoted)
+		}
+		return nil
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			if err := add(i); err != nil {
+				return nil, err
+			}
+			start = i + 1
+		}
+	}
+	if err := add(len(value)); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// scalar converts a single (inline) value: a quoted or plain string, or a flow list.
+func scalar(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		items, err := splitFlow(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(items, ","), nil
+	}
+	if strings.HasPrefix(value, "{") {
+		return "", fmt.Errorf("inline maps are not supported (%s)", value)
+	}
+	return unquote(value)
+}
+
+// splitKeyValue splits the line on the first separator found outside of quotes.
+func splitKeyValue(line string, separators string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.IndexByte(separators, c) >= 0:
+			return strings.TrimSpace(line[:i]), line[i+1:], true
+		}
+	}
+	return line, "", false
+}
+
+// yamlMapping reports whether the list item is a `key: value` pair (the colon followed by
+// a space or ending the item), so "localhost:8080" or "http://host" stay scalars.
+func yamlMapping(item string) bool {
+	_, value, found := splitKeyValue(item, ":")
+	return found && (len(value) == 0 || value[0] == ' ')
+}
+
+func decodeIni(raw []byte) (Config, error) {
+	data := make(Config)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(stripComment(scanner.Text(), "#;"))
+		if len(line) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("config: line %d: unsupported section (%s)", number, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if len(section) > 0 {
+				section += "."
+			}
+			continue
+		}
+
+		key, value, found := splitKeyValue(line, "=:")
+		if !found {
+			return nil, fmt.Errorf("config: line %d: expected key = value, got (%s)", number, line)
+		}
+		key, err := unquote(key)
+		if err != nil {
+			return nil, fmt.Errorf("config: line %d: %v", number, err)
+		}
+		if data[section+key], err = scalar(value); err != nil {
+			return nil, fmt.Errorf("config: line %d: %v", number, err)
+		}
+	}
+	return data, scanner.Err()
+}
+
+func decodeEnv(raw []byte) (Config, error) {
+	data := make(Config)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(stripComment(scanner.Text(), "#"))
+		if len(line) == 0 {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("config: line %d: expected KEY=value, got (%s)", number, line)
+		}
+		value, err := unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("config: line %d: %v", number, err)
+		}
+		data[envToKey(strings.TrimSpace(key))] = value
+	}
+	return data, scanner.Err()
+}
+
+func decodeYaml(raw []byte) (Config, error) {
+	type level struct {
+		indent int
+		prefix string
+	}
+
+	var (
+		data    = make(Config)
+		stack   []level
+		lists   = make(map[string][]string)
+		lastKey string // the last key with no inline value (may own nested keys or list items)
+		lastAt  = -1
+		lines   = strings.Split(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\n")
+	)
+
+	for index := 0; index < len(lines); index++ {
+		number := index + 1
+		text := stripComment(lines[index], "#")
+		trimmed := strings.TrimSpace(text)
+		if len(trimmed) == 0 || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("config: line %d: tabs are not allowed for indentation", number)
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if len(lastKey) == 0 || indent < lastAt {
+				return nil, fmt.Errorf("config: line %d: list item without a key", number)
+			}
+			item := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if yamlMapping(item) {
+				return nil, fmt.Errorf("config: line %d: lists of maps are not supported", number)
+			}
+			value, err := scalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("config: line %d: %v", number, err)
+			}
+			delete(data, lastKey)
+			lists[lastKey] = append(lists[lastKey], value)
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		prefix := ""
+		if len(stack) > 0 {
+			prefix = stack[len(stack)-1].prefix
+			delete(data, strings.TrimSuffix(prefix, "."))
+		}
+
+		key, value, found := splitKeyValue(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("config: line %d: expected key: value, got (%s)", number, trimmed)
+		}
+		key, err := unquote(key)
+		if err != nil {
+			return nil, fmt.Errorf("config: line %d: %v", number, err)
+		}
+		full := prefix + key
+		value = strings.TrimSpace(value)
+		lastKey, lastAt = "", -1
+
+		switch {
+		case len(value) == 0:
+			data[full] = ""
+			stack = append(stack, level{indent: indent, prefix: full + "."})
+			lastKey, lastAt = full, indent
+
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			var block []string
+			blockIndent := -1
+			for index+1 < len(lines) {
+				next := lines[index+1]
+				nextTrimmed := strings.TrimSpace(next)
+				nextIndent := len(next) - len(strings.TrimLeft(next, " "))
+				if len(nextTrimmed) > 0 && nextIndent <= indent {
+					break
+				}
+				index++
+				if len(nextTrimmed) == 0 {
+					block = append(block, "")
+					continue
+				}
+				if blockIndent < 0 {
+					blockIndent = nextIndent
+				}
+				if nextIndent < blockIndent {
+					return nil, fmt.Errorf("config: line %d: bad indentation of a block scalar", index+1)
+				}
+				block = append(block, next[blockIndent:])
+			}
+			for len(block) > 0 && len(block[len(block)-1]) == 0 {
+				block = block[:len(block)-1]
+			}
+			separator := "\n"
+			if value[0] == '>' {
+				separator = " "
+			}
+			data[full] = strings.Join(block, separator)
+
+		default:
+			if data[full], err = scalar(value); err != nil {
+				return nil, fmt.Errorf("config: line %d: %v", number, err)
+			}
+		}
+	}
+
+	for key, items := range lists {
+		data[key] = strings.Join(items, ",")
+	}
+	return data, nil
+}
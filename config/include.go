@@ -0,0 +1,112 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	keyInclude      = "include"    // list of files merged underneath the including one
+	keyEnvironment  = "config.env" // selects the per-environment overlay (unless ENV is set)
+	envEnvironment  = "ENV"
+	maxIncludeDepth = 16
+)
+
+// tree is the result of reading a config file together with its includes and overlay.
+type tree struct {
+	data   Config
+	origin map[string]string // key -> file that supplied the value
+	files  []string          // every file that was read (to be watched)
+}
+
+// readTree reads the file with all its includes, followed by the overlay for
+// the current environment (e.g. `config.production` or `app.production.yaml`), if one exists.
+func readTree(name string) (*tree, error) {
+	result := &tree{
+		data:   make(Config),
+		origin: make(map[string]string),
+	}
+	if err := result.read(name, nil); err != nil {
+		return nil, err
+	}
+
+	environment := os.Getenv(envEnvironment)
+	if len(environment) == 0 {
+		environment = result.data[keyEnvironment]
+	}
+	if len(environment) > 0 {
+		overlay := overlayName(name, environment)
+		if _, err := os.Stat(overlay); err == nil {
+			if err := result.read(overlay, nil); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (t *tree) read(name string, chain []string) error {
+	absolute, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	for _, visited := range chain {
+		if visited == absolute {
+			return fmt.Errorf("config: circular include of (%s) via %s", name, strings.Join(chain, " -> "))
+		}
+	}
+	if len(chain) > maxIncludeDepth {
+		return fmt.Errorf("config: includes are nested too deep at (%s)", name)
+	}
+
+	data, err := readFile(name)
+	if err != nil {
+		return err
+	}
+	t.files = append(t.files, name)
+
+	if includes, found := data[keyInclude]; found {
+		delete(data, keyInclude)
+		for _, include := range splitList(includes) {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(name), include)
+			}
+			if err := t.read(include, append(chain, absolute)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the including file overrides whatever it included
+	for key, value := range data {
+		t.data[key] = value
+		t.origin[key] = name
+	}
+	return nil
+}
+
+func (t *tree) sources() map[string]string {
+	sources := make(map[string]string, len(t.origin))
+	for key, file := range t.origin {
+		sources[key] = layerFile + " (" + file + ")"
+	}
+	return sources
+}
+
+// overlayName inserts the environment before the extension: `config` -> `config.production`,
+// `app.yaml` -> `app.production.yaml`.
+func overlayName(name, environment string) string {
+	extension := filepath.Ext(name)
+	if len(extension) == 0 || strings.HasPrefix(filepath.Base(name), ".") && filepath.Base(name) == extension {
+		return name + "." + environment
+	}
+	return strings.TrimSuffix(name, extension) + "." + environment + extension
+}
@@ -0,0 +1,157 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	layerDefault = "default"
+	layerFile    = "file"
+	layerEnv     = "env"
+	layerFlag    = "flag"
+	layerMemory  = "memory"
+
+	defaultEnvPrefix = "APP_"
+	flagPrefix       = "--"
+)
+
+// Loader builds a store out of several layers, each one overriding the previous:
+// defaults < config file (with its includes and overlay) < environment variables < command-line flags.
+type Loader struct {
+	Defaults Config // lowest priority values
+
+	File string // optional config file
+
+	// Environment variables starting with EnvPrefix are turned into keys by dropping
+	// the prefix, lower-casing and replacing `_` with `.` (`__` stands for a literal `_`),
+	// so APP_DB_HOST becomes db.host and APP_MAX__CONN becomes max_conn.
+	// An empty prefix disables this layer.
+	EnvPrefix string
+	Environ   []string // "key=value" list, os.Environ() when nil
+
+	// Arguments of the form --key=value (or just --key, meaning "yes") override everything else;
+	// other arguments are ignored. A nil list disables this layer.
+	Args []string
+
+	Strict bool // unresolved references fail the load (see also the `config.strict` key)
+
+	Schema *Schema // validates the merged values (on load and on every live reload)
+}
+
+// NewLoader returns a loader for the file with the default `APP_` environment
+// prefix and the command-line arguments of the process.
+func NewLoader(file string) *Loader {
+	return &Loader{
+		File:      file,
+		EnvPrefix: defaultEnvPrefix,
+		Args:      os.Args[1:],
+	}
+}
+
+// Load merges all the layers into a new store.
+func (l *Loader) Load() (*Store, error) {
+	snap, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	store := newStore(l.File, snap)
+	store.refresh = l.snapshot
+	store.follow()
+	return store, nil
+}
+
+func (l *Loader) snapshot() (*snapshot, error) {
+	data := make(Config)
+	sources := make(map[string]string)
+	set := func(key, value, source string) {
+		data[key] = value
+		sources[key] = source
+	}
+
+	for key, value := range l.Defaults {
+		set(key, value, layerDefault)
+	}
+
+	var files []string
+	if len(l.File) > 0 {
+		tree, err := readTree(l.File)
+		if err != nil {
+			return nil, err
+		}
+		for key, source := range tree.sources() {
+			set(key, tree.data[key], source)
+		}
+		files = tree.files
+	}
+
+	if len(l.EnvPrefix) > 0 {
+		environ := l.Environ
+		if environ == nil {
+			environ = os.Environ()
+		}
+		for _, entry := range environ {
+			name, value, found := strings.Cut(entry, "=")
+			if !found || !strings.HasPrefix(name, l.EnvPrefix) || len(name) == len(l.EnvPrefix) {
+				continue
+			}
+			set(envToKey(name[len(l.EnvPrefix):]), value, layerEnv+" ("+name+")")
+		}
+	}
+
+	for _, arg := range l.Args {
+		if !strings.HasPrefix(arg, flagPrefix) || len(arg) == len(flagPrefix) {
+			continue
+		}
+		key, value, found := strings.Cut(arg[len(flagPrefix):], "=")
+		if !found {
+			value = affirmative
+		}
+		set(key, value, layerFlag+" ("+flagPrefix+key+")")
+	}
+
+	snap, err := newSnapshot(data, l.Strict)
+	if err != nil {
+		return nil, err
+	}
+	snap.sources, snap.files = sources, files
+	if err := snap.validate(l.Schema, l.File); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func envToKey(name string) string {
+	parts := strings.Split(strings.ToLower(name), "__")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(part, "_", ".")
+	}
+	return strings.Join(parts, "_")
+}
+
+// Layered makes the package level functions use a layered config: the given defaults,
+// the config file, `APP_` environment variables and command-line flags.
+// It has to be called prior to the first use of the package level functions.
+func Layered(defaults Config) error {
+	loader := NewLoader(configFileName)
+	loader.Defaults = defaults
+	if _, err := os.Stat(configFileName); os.IsNotExist(err) {
+		loader.File = ""
+	}
+
+	store, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	SetDefault(store)
+	return nil
+}
+
+// Source describes where the value of the key in the default store came from.
+func Source(key string) string {
+	return Default().Source(key)
+}
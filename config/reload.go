@@ -0,0 +1,130 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/seamia/libs"
+)
+
+func (s *Store) liveReload() {
+
+	const scope = "live.config: "
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		libs.Failure(scope+"failed to create a watcher, err: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	// sync makes the watcher follow the files the current snapshot was read from (includes change)
+	sync := func() bool {
+		files := s.load().files
+		if len(files) == 0 {
+			files = []string{s.name}
+		}
+		wanted := make(map[string]bool, len(files))
+		for _, name := range files {
+			wanted[name] = true
+			if !watched[name] {
+				if err := watcher.Add(name); err != nil {
+					libs.Failure(scope+"failed to add a file (%s) to watcher, err: %v", name, err)
+					return false
+				}
+				watched[name] = true
+			}
+		}
+		for name := range watched {
+			if !wanted[name] {
+				_ = watcher.Remove(name)
+				delete(watched, name)
+			}
+		}
+		return true
+	}
+
+	if !sync() {
+		return
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+
+		case event, operational := <-watcher.Events:
+			if !operational {
+				libs.Warning(scope + "events channel closed")
+				return
+			}
+
+			// libs.Trace(scope+"got event: %v", event)
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				libs.Trace(scope+"modified file: %s", event.Name)
+			} else if event.Op&fsnotify.Remove == fsnotify.Remove {
+				delete(watched, event.Name)
+			} else {
+				continue
+			}
+
+			if !s.reload() || !sync() {
+				return
+			}
+		case err, operational := <-watcher.Errors:
+			if !operational {
+				libs.Warning(scope + "errors channel closed")
+				return
+			}
+			libs.Warning(scope+"watch error: %v", err)
+		}
+	}
+
+}
+
+func (s *Store) reload() bool {
+	const scope = "reload.config: "
+	// let the writer finish (and notice Close meanwhile)
+	select {
+	case <-s.stop:
+		return false
+	case <-time.After(1 * time.Second):
+	}
+	if fresh, err := s.refresh(); err == nil {
+		if value, found := fresh.data[keyLiveReload]; found && value != affirmative {
+			libs.Trace(scope + " no more live reloads")
+			return false
+		}
+		s.replace(fresh)
+
+	} else {
+		libs.Warning(scope+"failed to reload config file (%s), err: %v", s.name, err)
+	}
+
+	return true
+}
+
+// replace atomically swaps the current snapshot and notifies the subscribers.
+func (s *Store) replace(fresh *snapshot) {
+	const scope = "reload.config: "
+	old := s.snap.Swap(fresh)
+	diff := compare(old.data, fresh.data)
+
+	if fresh.debug {
+		for key, change := range diff.Changed {
+			libs.Trace(scope+"value for key [%s] changed from [%s] to [%s]", key, old.display(key, change.Old), fresh.display(key, change.New))
+		}
+		for key := range diff.Removed {
+			libs.Trace(scope+"removed key [%s] from config", key)
+		}
+		for key, value := range diff.Added {
+			libs.Trace(scope+"added new key [%s] with value [%s]", key, fresh.display(key, value))
+		}
+	}
+
+	s.notify(diff)
+}
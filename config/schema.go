@@ -0,0 +1,278 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seamia/libs"
+)
+
+const (
+	keySchema = "config.schema" // path of the schema file (relative to the config file)
+
+	schemaString   = "string"
+	schemaInt      = "int"
+	schemaFloat    = "float"
+	schemaBool     = "bool"
+	schemaDuration = "duration"
+	schemaSize     = "size"
+	schemaTime     = "time"
+	schemaList     = "list"
+)
+
+// keys that are understood by the package itself and are always known
+var builtinKeys = map[string]bool{
+	"debug": true, "trace": true, keyLiveReload: true, keyEnvironment: true, keyStrict: true, keySchema: true,
+}
+
+type (
+	// Schema describes the expected keys of a config, e.g.
+	//
+	//	{
+	//		"strict": true,
+	//		"keys": {
+	//			"db.host": {"type": "string", "required": true, "aliases": ["db.hostname"]},
+	//			"db.port": {"type": "int"},
+	//			"mode":    {"allowed": ["dev", "prod"]},
+	//			"name":    {"pattern": "^[a-z]+$"}
+	//		}
+	//	}
+	Schema struct {
+		Strict bool                 `json:"strict,omitempty"` // keys missing from the schema are problems
+		Keys   map[string]KeySchema `json:"keys"`
+
+		aliases map[string]string // deprecated name -> key
+	}
+
+	KeySchema struct {
+		Type        string   `json:"type,omitempty"` // string (default), int, float, bool, duration, size, time, list
+		Required    bool     `json:"required,omitempty"`
+		Allowed     []string `json:"allowed,omitempty"`
+		Pattern     string   `json:"pattern,omitempty"`
+		Aliases     []string `json:"aliases,omitempty"` // deprecated names still accepted for the key
+		Description string   `json:"description,omitempty"`
+
+		pattern *regexp.Regexp
+	}
+
+	// ValidationError lists every problem found in a config.
+	ValidationError struct {
+		Problems []string
+	}
+)
+
+func (e *ValidationError) Error() string {
+	return "config: invalid config:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// LoadSchema reads a (json) schema file.
+func LoadSchema(name string) (*Schema, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(raw)
+}
+
+// ParseSchema parses a (json) schema and compiles its patterns.
+func ParseSchema(raw []byte) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(stripJsonComments(raw), &schema); err != nil {
+		return nil, err
+	}
+
+	schema.aliases = make(map[string]string)
+	for key, entry := range schema.Keys {
+		switch entry.Type {
+		case "", schemaString, schemaInt, schemaFloat, schemaBool, schemaDuration, schemaSize, schemaTime, schemaList:
+		default:
+			return nil, fmt.Errorf("config: schema: unknown type (%s) of key (%s)", entry.Type, key)
+		}
+		if len(entry.Pattern) > 0 {
+			compiled, err := regexp.Compile(entry.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("config: schema: bad pattern of key (%s): %v", key, err)
+			}
+			entry.pattern = compiled
+			schema.Keys[key] = entry
+		}
+		for _, alias := range entry.Aliases {
+			if other, found := schema.aliases[alias]; found {
+				return nil, fmt.Errorf("config: schema: alias (%s) is used by both (%s) and (%s)", alias, other, key)
+			}
+			schema.aliases[alias] = key
+		}
+	}
+	return &schema, nil
+}
+
+// apply renames the deprecated aliases in the snapshot to their current keys.
+func (s *Schema) apply(snap *snapshot) {
+	for alias, key := range s.aliases {
+		value, found := snap.data[alias]
+		if !found {
+			continue
+		}
+		libs.Warning("config: key (%s) is deprecated, use (%s) instead", alias, key)
+		if _, taken := snap.data[key]; !taken {
+			snap.data[key] = value
+			snap.secret[key] = snap.secret[alias]
+			if source, found := snap.sources[alias]; found {
+				snap.sources[key] = source
+			}
+		}
+		delete(snap.data, alias)
+	}
+}
+
+// Validate checks the values against the schema and reports all the problems at once.
+func (s *Schema) Validate(values Config) error {
+	var problems []string
+	for key, entry := range s.Keys {
+		value, found := values[key]
+		if !found || len(value) == 0 {
+			if entry.Required {
+				problems = append(problems, fmt.Sprintf("key (%s) is required", key))
+			}
+			continue
+		}
+		if problem := entry.check(value); len(problem) > 0 {
+			problems = append(problems, fmt.Sprintf("key (%s): %s", key, problem))
+		}
+	}
+
+	if s.Strict {
+		for key := range values {
+			if _, known := s.Keys[key]; known || builtinKeys[key] || strings.HasPrefix(key, variablePrefix) {
+				continue
+			}
+			problem := fmt.Sprintf("key (%s) is unknown", key)
+			if suggestion := s.closest(key); len(suggestion) > 0 {
+				problem += fmt.Sprintf(" (did you mean %s?)", suggestion)
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// check returns a description of what is wrong with the value (empty if nothing).
+// The value itself is not included, as it may be a secret.
+func (k KeySchema) check(value string) string {
+	var err error
+	switch k.Type {
+	case schemaInt:
+		_, err = strconv.Atoi(value)
+	case schemaFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case schemaBool:
+		if _, found := parseBool(value); !found {
+			return "expected a bool"
+		}
+	case schemaDuration:
+		_, err = time.ParseDuration(value)
+	case schemaSize:
+		_, err = parseSize(value)
+	case schemaTime:
+		_, err = parseTime(value)
+	}
+	if err != nil {
+		return "expected a value of type " + k.Type
+	}
+
+	if len(k.Allowed) > 0 {
+		items := []string{value}
+		if k.Type == schemaList {
+			items = splitList(value)
+		}
+		for _, item := range items {
+			allowed := false
+			for _, candidate := range k.Allowed {
+				allowed = allowed || item == candidate
+			}
+			if !allowed {
+				return "value is not one of: " + strings.Join(k.Allowed, ", ")
+			}
+		}
+	}
+
+	if k.pattern != nil && !k.pattern.MatchString(value) {
+		return "value does not match the pattern " + k.Pattern
+	}
+	return ""
+}
+
+// closest suggests a known key that is a likely intended spelling of the unknown one.
+func (s *Schema) closest(unknown string) string {
+	best, bestDistance := "", len(unknown)/3+1
+	for key := range s.Keys {
+		if distance := editDistance(unknown, key); distance < bestDistance || distance == bestDistance && key < best {
+			best, bestDistance = key, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// validate applies the schema (the given one, or the one named by the `config.schema` key)
+// to the snapshot; base is the config file the schema path is relative to.
+func (s *snapshot) validate(schema *Schema, base string) error {
+	if schema == nil {
+		name := s.data[keySchema]
+		if len(name) == 0 {
+			return nil
+		}
+		if !filepath.IsAbs(name) && len(base) > 0 {
+			name = filepath.Join(filepath.Dir(base), name)
+		}
+		var err error
+		if schema, err = LoadSchema(name); err != nil {
+			return err
+		}
+	}
+
+	schema.apply(s)
+	return schema.Validate(s.data)
+}
+
+// Check reads the config file (with its includes and overlay) and validates it against
+// the schema (or the one named by its `config.schema` key), reporting all the problems.
+func Check(name string, schema *Schema) error {
+	_, err := fileSnapshot(name, schema)
+	return err
+}
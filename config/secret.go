@@ -0,0 +1,183 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	refFile   = "file:"   // ${file:/run/secrets/db_pw} - the content of the file
+	refSecret = "secret:" // ${secret:db_pw} - the value supplied by the secret provider
+
+	redacted          = "[redacted]"
+	defaultSecretsDir = "/run/secrets"
+	sealedNonceSize   = 24
+	sealedKeySize     = 32
+)
+
+// SecretProvider resolves `${secret:name}` references.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// SecretDir is a provider that keeps every secret in its own file inside the directory
+// (the way docker and kubernetes mount them).
+type SecretDir string
+
+func (d SecretDir) Secret(name string) (string, error) {
+	if len(name) == 0 || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("config: invalid secret name (%s)", name)
+	}
+	return readSecretFile(filepath.Join(string(d), name))
+}
+
+// SealedFile is a provider backed by a json dictionary of secrets, encrypted with
+// NaCl secretbox (see Seal) under a 32 byte key.
+type SealedFile struct {
+	path string
+	key  [sealedKeySize]byte
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+// NewSealedFile creates a provider for the sealed file; the file is opened on the first use.
+func NewSealedFile(path string, key []byte) (*SealedFile, error) {
+	if len(key) != sealedKeySize {
+		return nil, fmt.Errorf("config: sealed secrets key must be %d bytes long, got %d", sealedKeySize, len(key))
+	}
+	sealed := &SealedFile{path: path}
+	copy(sealed.key[:], key)
+	return sealed, nil
+}
+
+func (f *SealedFile) Secret(name string) (string, error) {
+	f.once.Do(func() {
+		raw, err := os.ReadFile(f.path)
+		if err != nil {
+			f.err = err
+			return
+		}
+		f.secrets, f.err = Unseal(raw, f.key[:])
+	})
+	if f.err != nil {
+		return "", f.err
+	}
+	if value, found := f.secrets[name]; found {
+		return value, nil
+	}
+	return "", fmt.Errorf("config: unknown secret (%s) in (%s)", name, f.path)
+}
+
+// Seal encrypts the dictionary of secrets for use with SealedFile.
+func Seal(secrets map[string]string, key []byte) ([]byte, error) {
+	if len(key) != sealedKeySize {
+		return nil, fmt.Errorf("config: sealed secrets key must be %d bytes long, got %d", sealedKeySize, len(key))
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [sealedNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	var secret [sealedKeySize]byte
+	copy(secret[:], key)
+	return secretbox.Seal(nonce[:], plain, &nonce, &secret), nil
+}
+
+// Unseal decrypts the output of Seal.
+func Unseal(sealed []byte, key []byte) (map[string]string, error) {
+	if len(key) != sealedKeySize {
+		return nil, fmt.Errorf("config: sealed secrets key must be %d bytes long, got %d", sealedKeySize, len(key))
+	}
+	if len(sealed) < sealedNonceSize+secretbox.Overhead {
+		return nil, errors.New("config: sealed secrets are too short")
+	}
+
+	var nonce [sealedNonceSize]byte
+	var secret [sealedKeySize]byte
+	copy(nonce[:], sealed)
+	copy(secret[:], key)
+	plain, ok := secretbox.Open(nil, sealed[sealedNonceSize:], &nonce, &secret)
+	if !ok {
+		return nil, errors.New("config: failed to decrypt sealed secrets (wrong key?)")
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+var (
+	secretProvider     SecretProvider = SecretDir(defaultSecretsDir)
+	secretProviderLock sync.Mutex
+)
+
+// SetSecretProvider replaces the provider used for `${secret:name}` references
+// (by default the secrets are read from the files in /run/secrets).
+func SetSecretProvider(provider SecretProvider) {
+	secretProviderLock.Lock()
+	defer secretProviderLock.Unlock()
+	secretProvider = provider
+}
+
+func currentSecretProvider() SecretProvider {
+	secretProviderLock.Lock()
+	defer secretProviderLock.Unlock()
+	return secretProvider
+}
+
+func readSecretFile(name string) (string, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
+// resolveReference resolves `file:` and `secret:` references; found is false for other keys.
+func resolveReference(key string) (value string, found bool, err error) {
+	switch {
+	case strings.HasPrefix(key, refFile):
+		value, err = readSecretFile(strings.TrimPrefix(key, refFile))
+		return value, true, err
+	case strings.HasPrefix(key, refSecret):
+		provider := currentSecretProvider()
+		if provider == nil {
+			return "", true, errors.New("config: no secret provider")
+		}
+		value, err = provider.Secret(strings.TrimPrefix(key, refSecret))
+		return value, true, err
+	}
+	return "", false, nil
+}
+
+// display returns the value of the key as it may appear in logs.
+func (s *snapshot) display(key, value string) string {
+	return displayValue(s != nil && s.secret[key], value)
+}
+
+func displayValue(sensitive bool, value string) string {
+	if sensitive {
+		return redacted
+	}
+	return value
+}
@@ -0,0 +1,276 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/seamia/libs"
+)
+
+// Store holds one independent set of configuration values.
+// The values are kept as an immutable snapshot that is swapped atomically on reload.
+type Store struct {
+	name        string // file the data came from (empty for readers and maps)
+	snap        atomic.Pointer[snapshot]
+	refresh     func() (*snapshot, error) // re-reads the data on live reload
+	lock        sync.Mutex                // guards the subscriptions
+	watchers    map[string][]func(old, new string)
+	subscribers []func(diff Diff)
+
+	stop      chan struct{} // closed by Close, stops the live reload
+	stopped   chan struct{} // closed once the live reload is over
+	closeOnce sync.Once
+}
+
+type snapshot struct {
+	data    Config
+	sources map[string]string // where each value came from (file backed stores only)
+	files   []string          // files the data was read from (watched by live reload)
+	secret  map[string]bool   // keys holding secrets (never logged)
+	debug   bool
+	trace   bool
+}
+
+// New creates a store over an in-memory set of values.
+// The map is copied and `$` references in it are expanded; the values that
+// fail to expand are kept as they are (see NewStrict).
+func New(values Config) *Store {
+	data := make(Config, len(values))
+	for k, v := range values {
+		data[k] = v
+	}
+	snap, err := newSnapshot(data, false)
+	if err != nil {
+		libs.Warning("config: %v", err)
+		snap = &snapshot{data: data, debug: data["debug"] == affirmative, trace: data["trace"] == affirmative}
+	}
+	return newStore("", snap)
+}
+
+// NewStrict is like New, but fails on unresolved references.
+func NewStrict(values Config) (*Store, error) {
+	data := make(Config, len(values))
+	for k, v := range values {
+		data[k] = v
+	}
+	snap, err := newSnapshot(data, true)
+	if err != nil {
+		return nil, err
+	}
+	return newStore("", snap), nil
+}
+
+// Load reads and processes a config file (json, yaml, ini or .env, see detectFormat).
+// If the file asks for `live.reload`, the store follows the changes to the file (until Close).
+// A file that fails the validation against its schema (see the `config.schema` key) fails to load,
+// and the same goes for the live reloads: an invalid file does not replace the current data.
+func Load(name string) (*Store, error) {
+	refresh := func() (*snapshot, error) {
+		return fileSnapshot(name, nil)
+	}
+
+	snap, err := refresh()
+	if err != nil {
+		return nil, err
+	}
+	store := newStore(name, snap)
+	store.refresh = refresh
+	store.follow()
+	return store, nil
+}
+
+func fileSnapshot(name string, schema *Schema) (*snapshot, error) {
+	files, err := readTree(name)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := newSnapshot(files.data, false)
+	if err != nil {
+		return nil, err
+	}
+	snap.sources, snap.files = files.sources(), files.files
+	if err := snap.validate(schema, name); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// follow starts the live reload of the store's file, if the file asks for it.
+func (s *Store) follow() {
+	if value, _ := s.Lookup(keyLiveReload); value == affirmative && len(s.name) > 0 && s.refresh != nil {
+		libs.Trace("config: live.reload is requested")
+		s.stop, s.stopped = make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(s.stopped)
+			s.liveReload()
+		}()
+	}
+}
+
+// Close stops following the changes to the file (see live.reload); the values stay available.
+func (s *Store) Close() error {
+	if s == nil || s.stop == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.stopped
+	return nil
+}
+
+func readFile(name string) (Config, error) {
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAs(name, raw)
+}
+
+// Read reads and processes a config from the provided reader (the format is detected by the content).
+func Read(from io.Reader) (*Store, error) {
+	if from == nil {
+		return nil, errors.New("config: nil reader")
+	}
+	raw, err := io.ReadAll(from)
+	if err != nil {
+		return nil, err
+	}
+	return parse("", raw)
+}
+
+func parse(name string, raw []byte) (*Store, error) {
+	data, err := decodeAs(name, raw)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := newSnapshot(data, false)
+	if err != nil {
+		return nil, err
+	}
+	return newStore(name, snap), nil
+}
+
+func newStore(name string, snap *snapshot) *Store {
+	store := &Store{name: name}
+	store.snap.Store(snap)
+	return store
+}
+
+// newSnapshot expands the references in the data. In strict mode (the `config.strict` key
+// or the caller's request) an unresolved reference is an error.
+func newSnapshot(data Config, strict bool) (*snapshot, error) {
+	snap := &snapshot{data: data}
+
+	if value, found := data["debug"]; found {
+		snap.debug = value == affirmative
+	}
+
+	if value, found := data["trace"]; found {
+		snap.trace = value == affirmative
+	}
+
+	if err := snap.expand(strict || data[keyStrict] == affirmative); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *Store) load() *snapshot {
+	if s == nil {
+		return nil
+	}
+	return s.snap.Load()
+}
+
+// Name returns the name of the file the store was loaded from (if any).
+func (s *Store) Name() string {
+	if s == nil {
+		return ""
+	}
+	return s.name
+}
+
+// Lookup returns the value for the key and whether it was present.
+func (s *Store) Lookup(key string) (string, bool) {
+	snap := s.load()
+	if snap == nil {
+		return "", false
+	}
+	value, found := snap.data[key]
+	return value, found
+}
+
+func (s *Store) Get(key string) string {
+	if value, ok := s.Lookup(key); ok {
+		return value
+	}
+
+	if s.Debug() {
+		libs.Trace("failed to find key (%s) in config", key)
+	}
+	return ""
+}
+
+func (s *Store) Flag(key string) bool {
+	return s.Get(key) == affirmative
+}
+
+func (s *Store) GetInt(key string, fallback int) int {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, err := strconv.Atoi(txt); err != nil {
+			libs.Warning("failed to convert value (%v) for key (%s) into int", s.load().display(key, txt), key)
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+// Source describes where the value of the key came from, e.g. "file (./config)",
+// "env (APP_DB_HOST)" or "flag (--db.host)"; it is empty for unknown keys.
+func (s *Store) Source(key string) string {
+	snap := s.load()
+	if snap == nil {
+		return ""
+	}
+	if _, found := snap.data[key]; !found {
+		return ""
+	}
+	if source, found := snap.sources[key]; found {
+		return source
+	}
+	if len(s.name) > 0 {
+		return layerFile + " (" + s.name + ")"
+	}
+	return layerMemory
+}
+
+// Values returns a copy of all the values held by the store.
+func (s *Store) Values() Config {
+	snap := s.load()
+	if snap == nil {
+		return nil
+	}
+	values := make(Config, len(snap.data))
+	for k, v := range snap.data {
+		values[k] = v
+	}
+	return values
+}
+
+func (s *Store) Debug() bool {
+	snap := s.load()
+	return snap != nil && snap.debug
+}
+
+func (s *Store) Trace() bool {
+	snap := s.load()
+	return snap != nil && snap.trace
+}
@@ -0,0 +1,196 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seamia/libs"
+)
+
+var (
+	truthy = map[string]bool{
+		"yes": true, "y": true, "true": true, "t": true, "on": true, "1": true, "enable": true, "enabled": true,
+		"no": false, "n": false, "false": false, "f": false, "off": false, "0": false, "disable": false, "disabled": false,
+	}
+
+	sizeUnits = map[string]float64{
+		"":    1,
+		"b":   1,
+		"k":   1 << 10,
+		"kb":  1e3,
+		"kib": 1 << 10,
+		"m":   1 << 20,
+		"mb":  1e6,
+		"mib": 1 << 20,
+		"g":   1 << 30,
+		"gb":  1e9,
+		"gib": 1 << 30,
+		"t":   1 << 40,
+		"tb":  1e12,
+		"tib": 1 << 40,
+	}
+
+	timeLayouts = []string{
+		time.RFC3339Nano,
+		time.RFC3339,
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	}
+)
+
+func (s *Store) conversionFailure(txt, key, kind string) {
+	libs.Warning("failed to convert value (%v) for key (%s) into %s", s.load().display(key, txt), key, kind)
+}
+
+// GetDuration returns the value of the key parsed as a time.Duration (e.g. "30s", "1h15m").
+func (s *Store) GetDuration(key string, fallback time.Duration) time.Duration {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, err := time.ParseDuration(txt); err != nil {
+			s.conversionFailure(txt, key, "duration")
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+func (s *Store) GetFloat(key string, fallback float64) float64 {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, err := strconv.ParseFloat(txt, 64); err != nil {
+			s.conversionFailure(txt, key, "float")
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+// GetBool accepts yes/no, true/false, on/off, 1/0 (and a few more spellings), case insensitive.
+func (s *Store) GetBool(key string, fallback bool) bool {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, found := parseBool(txt); !found {
+			s.conversionFailure(txt, key, "bool")
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+// GetList splits the value of the key on commas, trimming the spaces around each element
+// and dropping the empty ones.
+func (s *Store) GetList(key string, fallback []string) []string {
+	if txt := s.Get(key); len(txt) > 0 {
+		if list := splitList(txt); len(list) > 0 {
+			return list
+		}
+	}
+	return fallback
+}
+
+// GetSize returns the value of the key parsed as a number of bytes (e.g. "512", "16MiB", "1.5GB", "64k").
+func (s *Store) GetSize(key string, fallback int64) int64 {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, err := parseSize(txt); err != nil {
+			s.conversionFailure(txt, key, "size")
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+// GetTime returns the value of the key parsed as RFC 3339 time, or as a plain date/time.
+func (s *Store) GetTime(key string, fallback time.Time) time.Time {
+	if txt := s.Get(key); len(txt) > 0 {
+		if value, err := parseTime(txt); err != nil {
+			s.conversionFailure(txt, key, "time")
+		} else {
+			return value
+		}
+	}
+	return fallback
+}
+
+func parseBool(txt string) (bool, bool) {
+	value, found := truthy[strings.ToLower(strings.TrimSpace(txt))]
+	return value, found
+}
+
+func splitList(txt string) []string {
+	var list []string
+	for _, item := range strings.Split(txt, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseSize(txt string) (int64, error) {
+	txt = strings.TrimSpace(txt)
+	split := len(txt)
+	for split > 0 && (txt[split-1] < '0' || txt[split-1] > '9') && txt[split-1] != '.' {
+		split--
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(txt[:split]), 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := strings.ToLower(strings.TrimSpace(txt[split:]))
+	multiplier, found := sizeUnits[unit]
+	if !found {
+		return 0, fmt.Errorf("unknown size unit (%s)", unit)
+	}
+
+	size := number * multiplier
+	// math.MaxInt64 rounds up to 2^63 as a float, so it is out of range itself
+	if size < 0 || size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size (%s) is out of range", txt)
+	}
+	return int64(size), nil
+}
+
+func parseTime(txt string) (time.Time, error) {
+	var err error
+	for _, layout := range timeLayouts {
+		var value time.Time
+		if value, err = time.Parse(layout, txt); err == nil {
+			return value, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	return Default().GetDuration(key, fallback)
+}
+
+func GetFloat(key string, fallback float64) float64 {
+	return Default().GetFloat(key, fallback)
+}
+
+func GetBool(key string, fallback bool) bool {
+	return Default().GetBool(key, fallback)
+}
+
+func GetList(key string, fallback []string) []string {
+	return Default().GetList(key, fallback)
+}
+
+func GetSize(key string, fallback int64) int64 {
+	return Default().GetSize(key, fallback)
+}
+
+func GetTime(key string, fallback time.Time) time.Time {
+	return Default().GetTime(key, fallback)
+}
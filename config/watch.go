@@ -0,0 +1,121 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+type (
+	// Change describes a key whose value was modified by a reload.
+	Change struct {
+		Old string
+		New string
+	}
+
+	// Diff describes the differences between two versions of a config.
+	Diff struct {
+		Added   Config
+		Removed Config
+		Changed map[string]Change
+	}
+)
+
+// Empty reports whether the diff holds no differences.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func compare(before, after Config) Diff {
+	diff := Diff{
+		Added:   make(Config),
+		Removed: make(Config),
+		Changed: make(map[string]Change),
+	}
+
+	for key, oldValue := range before {
+		if newValue, found := after[key]; found {
+			if oldValue != newValue {
+				diff.Changed[key] = Change{Old: oldValue, New: newValue}
+			}
+		} else {
+			diff.Removed[key] = oldValue
+		}
+	}
+	for key, value := range after {
+		if _, found := before[key]; !found {
+			diff.Added[key] = value
+		}
+	}
+	return diff
+}
+
+// Watch registers a callback invoked whenever the value of the key changes
+// (including being added or removed) on reload.
+func (s *Store) Watch(key string, callback func(old, new string)) {
+	if s == nil || callback == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[string][]func(old, new string))
+	}
+	s.watchers[key] = append(s.watchers[key], callback)
+}
+
+// Subscribe registers a callback invoked with the full diff on every reload
+// that changed anything.
+func (s *Store) Subscribe(callback func(diff Diff)) {
+	if s == nil || callback == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.subscribers = append(s.subscribers, callback)
+}
+
+func (s *Store) notify(diff Diff) {
+	if diff.Empty() {
+		return
+	}
+
+	s.lock.Lock()
+	subscribers := append([]func(Diff){}, s.subscribers...)
+	type call struct {
+		callback func(old, new string)
+		old, new string
+	}
+	var calls []call
+	for key, callbacks := range s.watchers {
+		var old, new string
+		if change, found := diff.Changed[key]; found {
+			old, new = change.Old, change.New
+		} else if value, found := diff.Added[key]; found {
+			new = value
+		} else if value, found := diff.Removed[key]; found {
+			old = value
+		} else {
+			continue
+		}
+		for _, callback := range callbacks {
+			calls = append(calls, call{callback, old, new})
+		}
+	}
+	s.lock.Unlock()
+
+	for _, c := range calls {
+		c.callback(c.old, c.new)
+	}
+	for _, callback := range subscribers {
+		callback(diff)
+	}
+}
+
+// Watch registers a key callback with the default store.
+func Watch(key string, callback func(old, new string)) {
+	Default().Watch(key, callback)
+}
+
+// Subscribe registers a diff callback with the default store.
+func Subscribe(callback func(diff Diff)) {
+	Default().Subscribe(callback)
+}
@@ -8,73 +8,98 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/elliotchance/sshtunnel"
 	_ "github.com/go-sql-driver/mysql"
 	libio "github.com/seamia/libs/iox"
+	"github.com/seamia/libs/ssh"
+)
+
+// the host key of a user@host tunnel is trusted (and recorded) the first time it is seen
+const defaultHostKeyCheck = "accept-new"
+
+var (
+	tunnelsGuard sync.Mutex
+	tunnels      = make(map[string]bool) // user@host tunnels registered with the ssh package
 )
 
 type Database struct {
 	db     *sql.DB
-	tunnel *sshtunnel.SSHTunnel
+	tunnel *ssh.Forward
 }
 
+// Open connects to the database described by the config; with `tunnel` set, the connection
+// goes through an ssh port forwarding to `destination`. The tunnel is either the name of an
+// ssh.info entry or user@host[:port], authenticated with `key`; the host key of the latter is
+// checked as `host.key.check` says ("accept-new" by default: a host seen for the first time
+// is added to known_hosts, a changed key is refused).
 func (db *Database) Open(configName string) error {
 	cnf, err := libio.LoadJsonAsDictionary(configName)
 	if err != nil {
 		return err
 	}
 
-	if len(cnf["tunnel"]) > 0 {
-		// Setup the tunnel, but do not yet start it yet.
-		if db.tunnel, err = sshtunnel.NewSSHTunnel(
-			// User and host of tunnel server, it will default to port 22 if not specified.
-			cnf["tunnel"],
-
-			// Pick ONE of the following authentication methods:
-			sshtunnel.PrivateKeyFile(cnf["key"]), // 1. private key
-			//		ssh.Password("password"),                            // 2. password
-			//		sshtunnel.SSHAgent(),                                // 3. ssh-agent
-
-			// The destination host and port of the actual server.
-			cnf["destination"],
-
-			// The local port you want to bind the remote port to.
-			// Specifying "0" will lead to a random port.
-			"0",
-		); err != nil {
+	if tunnel := cnf["tunnel"]; len(tunnel) > 0 {
+		if err := registerTunnel(tunnel, cnf); err != nil {
 			return err
 		}
-
-		// You can provide a logger for debugging, or remove this line to // make it silent.
-		// tunnel.Log = log.New(os.Stdout, "", log.Ldate|log.Lmicroseconds)
-
-		// Start the server in the background. You will need to wait a
-		// small amount of time for it to bind to the localhost port
-		// before you can start sending connections.
-		go db.tunnel.Start()
-		time.Sleep(100 * time.Millisecond)
-	}
-
-	if db.tunnel != nil {
-		cnf["host"] = db.tunnel.Local.String()
+		// the forwarding accepts connections as soon as it is returned
+		if db.tunnel, err = ssh.ForwardLocal(tunnel, "", cnf["destination"]); err != nil {
+			return err
+		}
+		cnf["host"] = db.tunnel.Addr().String()
 	}
 
 	const parseTime = "?parseTime=true&charset=utf8mb4&collation=utf8mb4_unicode_ci"
 
 	db.db, err = sql.Open(cnf["driver"], cnf["user"]+":"+cnf["password"]+"@tcp("+cnf["host"]+")/"+cnf["db"]+parseTime)
 	if err != nil {
+		db.Close()
 		return err
 	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return err
 	}
 
 	return nil
 }
 
+// registerTunnel makes a user@host tunnel known to the ssh package, once: registering it
+// again would replace the connection (and tear down the tunnels of the databases open already).
+func registerTunnel(tunnel string, cnf map[string]string) error {
+	user, address, found := strings.Cut(tunnel, "@")
+	if !found {
+		// the name of an ssh.info entry
+		return nil
+	}
+
+	tunnelsGuard.Lock()
+	defer tunnelsGuard.Unlock()
+	if tunnels[tunnel] {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	info := ssh.Dict{"address": address, "user": user, "key": cnf["key"], "host.key.check": defaultHostKeyCheck}
+	for _, key := range []string{"known_hosts", "fingerprint", "host.key.check"} {
+		if value := cnf[key]; len(value) > 0 {
+			info[key] = value
+		}
+	}
+	if err := ssh.Register(tunnel, info); err != nil {
+		return err
+	}
+	tunnels[tunnel] = true
+	return nil
+}
+
 func (db Database) DB() *sql.DB {
 	return db.db
 }
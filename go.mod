@@ -3,10 +3,10 @@ module github.com/seamia/libs
 go 1.24.3
 
 require (
-	github.com/elliotchance/sshtunnel v1.6.2
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/go-sql-driver/mysql v1.10.0
 	github.com/pkg/sftp v1.13.9
+	github.com/seamia/libs/ssh v0.1.0
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.39.0
 )
@@ -5,37 +5,169 @@
 package iox
 
 import (
+	"context"
+	"errors"
 	"io"
+	"sync"
+	"time"
 
 	. "github.com/seamia/libs"
 )
 
+// number of consecutive reads/writes moving no data before giving up (as bufio does)
+const maxEmptyRounds = 100
+
+// ReadAll fills the buffer from the reader (see ReadAllContext).
 func ReadAll(from io.Reader, buffer []byte, trace Tracer) error {
+	return ReadAllContext(context.Background(), from, buffer, trace)
+}
+
+// ReadAllContext fills the buffer from the reader. It returns io.EOF if the stream ended before any
+// data was read and io.ErrUnexpectedEOF if it ended part way (like io.ReadFull).
+// The deadline of the context (if any) is applied to the streams implementing SetReadDeadline
+// (ReadDeadline), which are also unblocked when the context is cancelled; such a stream has no
+// deadline afterwards, otherwise it keeps the one set by the caller. For the other streams
+// the context is checked between the reads.
+func ReadAllContext(ctx context.Context, from io.Reader, buffer []byte, trace Tracer) error {
+	trace = orQuiet(trace)
 	trace("reading %v bytes...", len(buffer))
+
+	var stop func()
+	if rd, found := from.(ReadDeadline); found && rd != nil {
+		stop = bound(ctx, rd.SetReadDeadline)
+	}
+
+	total, empty := 0, 0
 	for len(buffer) > 0 {
+		if err := ctx.Err(); err != nil {
+			return finish(stop, err)
+		}
 		bytesRead, err := from.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				trace("read error: %v", err)
-				return err
+		buffer, total = buffer[bytesRead:], total+bytesRead
+
+		switch {
+		case err == io.EOF && len(buffer) == 0:
+			// the data ends exactly at the end of the buffer
+		case err == io.EOF && total == 0:
+			return finish(stop, io.EOF)
+		case err == io.EOF:
+			trace("read error: stream ended after %v bytes, %v missing", total, len(buffer))
+			return finish(stop, io.ErrUnexpectedEOF)
+		case err != nil:
+			trace("read error: %v", err)
+			return finish(stop, contextError(ctx, err))
+		}
+
+		if bytesRead == 0 {
+			if empty++; empty >= maxEmptyRounds {
+				return finish(stop, io.ErrNoProgress)
 			}
+		} else {
+			empty = 0
 		}
-		// trace("    read %v bytes...", bytesRead)
-		buffer = buffer[bytesRead:]
 	}
-	return nil
+	return finish(stop, nil)
 }
 
+// WriteAll writes the whole buffer to the writer (see WriteAllContext).
 func WriteAll(to io.Writer, buffer []byte, trace Tracer) error {
+	return WriteAllContext(context.Background(), to, buffer, trace)
+}
+
+// WriteAllContext writes the whole buffer to the writer, applying the context as ReadAllContext
+// does (through SetWriteDeadline, see WriteDeadline).
+func WriteAllContext(ctx context.Context, to io.Writer, buffer []byte, trace Tracer) error {
+	trace = orQuiet(trace)
 	trace("writing %v bytes...", len(buffer))
+
+	var stop func()
+	if wd, found := to.(WriteDeadline); found && wd != nil {
+		stop = bound(ctx, wd.SetWriteDeadline)
+	}
+
+	empty := 0
 	for len(buffer) > 0 {
+		if err := ctx.Err(); err != nil {
+			return finish(stop, err)
+		}
 		bytesWritten, err := to.Write(buffer)
 		if err != nil {
 			trace("writeAll error: %v", err)
-			return err
+			return finish(stop, contextError(ctx, err))
 		}
 		trace("    wrote %v bytes...", bytesWritten)
 		buffer = buffer[bytesWritten:]
+
+		if bytesWritten == 0 {
+			if empty++; empty >= maxEmptyRounds {
+				return finish(stop, io.ErrShortWrite)
+			}
+		} else {
+			empty = 0
+		}
+	}
+	return finish(stop, nil)
+}
+
+// bound applies the deadline of the context (if any) to the stream and expires it when the
+// context is cancelled; the returned func clears the deadline, but only if it was changed:
+// otherwise the stream keeps whatever deadline the caller has set (nil for a context that
+// can be neither).
+func bound(ctx context.Context, setDeadline func(time.Time) error) func() {
+	if ctx.Done() == nil {
+		return nil
+	}
+	deadline, changed := ctx.Deadline()
+	if changed && setDeadline(deadline) != nil {
+		return nil
+	}
+
+	var guard sync.Mutex
+	finished := false
+	stopWatching := context.AfterFunc(ctx, func() {
+		guard.Lock()
+		defer guard.Unlock()
+		if !finished {
+			// a deadline in the past unblocks the pending call
+			setDeadline(time.Unix(1, 0))
+			changed = true
+		}
+	})
+
+	return func() {
+		stopWatching()
+		guard.Lock()
+		defer guard.Unlock()
+		finished = true
+		if changed {
+			setDeadline(time.Time{})
+		}
+	}
+}
+
+func finish(stop func(), err error) error {
+	if stop != nil {
+		stop()
+	}
+	return err
+}
+
+// contextError reports the context's error for the failures caused by the context
+// (an expired deadline or a cancellation).
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var timeout interface{ Timeout() bool }
+	if _, hasDeadline := ctx.Deadline(); hasDeadline && errors.As(err, &timeout) && timeout.Timeout() {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func orQuiet(trace Tracer) Tracer {
+	if trace == nil {
+		return func(string, ...any) {}
 	}
-	return nil
+	return trace
 }
@@ -0,0 +1,90 @@
+// Copyright 2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAllTruncated(t *testing.T) {
+	buffer := make([]byte, 10)
+	if err := ReadAll(strings.NewReader("short"), buffer, nil); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := ReadAll(strings.NewReader(""), buffer, nil); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := ReadAll(strings.NewReader("0123456789"), buffer, nil); err != nil || string(buffer) != "0123456789" {
+		t.Fatalf("unexpected result %q (%v)", buffer, err)
+	}
+}
+
+func TestReadAllDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	go server.Write([]byte("part"))
+
+	started := time.Now()
+	err := ReadAllContext(ctx, client, make([]byte, 10), nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to expire, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Fatal("the read was not bounded by the deadline")
+	}
+
+	// the deadline does not outlive the call
+	go server.Write([]byte("0123456789"))
+	if err := ReadAll(client, make([]byte, 10), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteAllCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := WriteAllContext(ctx, client, bytes.Repeat([]byte("x"), 1024), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the write to be cancelled, got %v", err)
+	}
+}
+
+func TestReadAllKeepsDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// a context without a deadline leaves the one of the caller alone
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Write([]byte("0123456789"))
+	if err := ReadAllContext(ctx, client, make([]byte, 10), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	if err := ReadAll(client, make([]byte, 10), nil); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected the deadline of the caller to expire, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Fatal("the deadline of the caller was cleared")
+	}
+}
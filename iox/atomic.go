@@ -0,0 +1,139 @@
+// Copyright 2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AtomicWriter writes a file so that it is either replaced entirely or not at all:
+// the data goes to a temp file next to it, which is renamed over the file on Close.
+type AtomicWriter struct {
+	name string
+	temp string
+	file *os.File
+	done bool
+}
+
+var errAtomicDone = errors.New("atomic writer is already closed")
+
+// CreateAtomicWriter starts writing the file (created with perm, before umask, as os.WriteFile does;
+// an existing file keeps its mode). A symlink stays in place: the file it points to is replaced.
+// Nothing is visible at the path until Close; Abort discards what was written.
+func CreateAtomicWriter(name string, perm os.FileMode) (*AtomicWriter, error) {
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		name = resolved
+	}
+	keepMode := false
+	if info, err := os.Stat(name); err == nil {
+		perm, keepMode = info.Mode().Perm(), true
+	}
+
+	dir, base := filepath.Split(name)
+	if len(dir) == 0 {
+		dir = "."
+	}
+
+	for attempt := 0; ; attempt++ {
+		suffix := make([]byte, 6)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		temp := filepath.Join(dir, "."+base+".tmp-"+hex.EncodeToString(suffix))
+		file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if err == nil && keepMode {
+			// the mode of the existing file is not subject to umask
+			if err = file.Chmod(perm); err != nil {
+				file.Close()
+				os.Remove(temp)
+				onError("failed to set the mode of the temp file for [%s], due to: %v", name, err)
+				return nil, err
+			}
+		}
+		if err == nil {
+			return &AtomicWriter{name: name, temp: temp, file: file}, nil
+		}
+		if !errors.Is(err, os.ErrExist) || attempt >= 10 {
+			onError("failed to create temp file for [%s], due to: %v", name, err)
+			return nil, err
+		}
+	}
+}
+
+func (w *AtomicWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errAtomicDone
+	}
+	return w.file.Write(p)
+}
+
+// Close flushes the data to the disk and puts the file in place (replacing the old one).
+// On failure the old file is left intact.
+func (w *AtomicWriter) Close() error {
+	if w.done {
+		return errAtomicDone
+	}
+	w.done = true
+
+	if err := w.file.Sync(); err != nil {
+		w.discard()
+		return fmt.Errorf("sync [%s]: %w", w.name, err)
+	}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.temp)
+		return fmt.Errorf("close [%s]: %w", w.name, err)
+	}
+	if err := os.Rename(w.temp, w.name); err != nil {
+		os.Remove(w.temp)
+		return err
+	}
+	return syncDir(filepath.Dir(w.name))
+}
+
+// Abort discards the data written so far; the file is left as it was.
+func (w *AtomicWriter) Abort() error {
+	if w.done {
+		return errAtomicDone
+	}
+	w.done = true
+	return w.discard()
+}
+
+func (w *AtomicWriter) discard() error {
+	w.file.Close()
+	return os.Remove(w.temp)
+}
+
+// syncDir makes the rename durable (directories cannot be synced on windows).
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	handle, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return handle.Sync()
+}
+
+// WriteFileAtomic is os.WriteFile done through an AtomicWriter.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	w, err := CreateAtomicWriter(name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicWriter(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := CreateAtomicWriter(name, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("half-written"))
+	if content, _ := os.ReadFile(name); string(content) != "old" {
+		t.Fatalf("the file changed before Close: %q", content)
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(name); string(content) != "old" {
+		t.Fatalf("the file changed after Abort: %q", content)
+	}
+
+	if err := SaveJson(name, map[string]string{"key": "value"}, false); err != nil {
+		t.Fatal(err)
+	}
+	var loaded map[string]string
+	if err := JsonLoadUnmarshal(name, &loaded); err != nil || loaded["key"] != "value" {
+		t.Fatalf("unexpected content %v (%v)", loaded, err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+}
+
+func TestAtomicWriterKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "secret.json")
+	if err := os.WriteFile(name, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveJson(name, map[string]string{"key": "value"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("the mode was not kept: %v (%v)", info.Mode(), err)
+	}
+
+	link := filepath.Join(dir, "link.json")
+	if err := os.Symlink(name, link); err != nil {
+		t.Skip("symlinks are not supported:", err)
+	}
+	if err := WriteFileAtomic(link, []byte("through the link"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("the symlink was replaced: %v (%v)", info.Mode(), err)
+	}
+	if content, _ := os.ReadFile(name); string(content) != "through the link" {
+		t.Fatalf("the target of the symlink was not written: %q", content)
+	}
+	if info, _ := os.Stat(name); info.Mode().Perm() != 0600 {
+		t.Fatalf("the mode of the target was not kept: %v", info.Mode())
+	}
+}
@@ -58,7 +58,7 @@ func (w *createOnWriteWriter) Write(p []byte) (n int, err error) {
 		return w.handler.Write(p)
 
 	case streamClosed:
-		return 0, fmt.Errorf("", w.name)
+		return 0, fmt.Errorf("write to closed file [%s]", w.name)
 	}
 	panic("unreachable")
 }
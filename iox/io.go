@@ -65,7 +65,7 @@ func SaveJson(filename string, payload interface{}, compress bool) error {
 		data = zip.Compress(data)
 	}
 
-	if err := os.WriteFile(filename, data, 0666); err != nil {
+	if err := WriteFileAtomic(filename, data, 0666); err != nil {
 		return err
 	}
 
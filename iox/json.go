@@ -21,7 +21,7 @@ func JsonSaveMarshal(filename string, mapping any) error {
 			return err
 		}
 	}
-	if err := os.WriteFile(filename, raw, 0644); err != nil {
+	if err := WriteFileAtomic(filename, raw, 0644); err != nil {
 		onError("failed to write file [%s], due to: %v", filename, err)
 		return err
 	}
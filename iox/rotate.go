@@ -0,0 +1,244 @@
+// Copyright 2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultKeep    = 7
+	compressedExt  = ".gz"
+	rotatedLogPerm = 0644
+
+	// the usual rotation periods (see RotateOptions.Every)
+	Hourly = time.Hour
+	Daily  = 24 * time.Hour
+)
+
+// RotateOptions control when and how a RotatingWriter rotates its file.
+type RotateOptions struct {
+	MaxSize  int64         // rotate before the file grows past that many bytes (0: no size limit)
+	Every    time.Duration // rotate on the boundaries of the period, e.g. Hourly or Daily (at local midnight)
+	Keep     int           // number of rotated files kept (7 when zero)
+	Compress bool          // gzip the rotated files
+	OnSignal bool          // rotate on SIGHUP
+}
+
+// RotatingWriter writes to a file that is rotated into name.1, name.2, ... (name.1.gz, ... when compressed),
+// the oldest generations being removed. Like CreateWriter, the file is only created by the first write.
+type RotatingWriter struct {
+	name string
+	opts RotateOptions
+	now  func() time.Time
+
+	guard    sync.Mutex // guards the fields below
+	file     *os.File
+	size     int64
+	deadline time.Time // the time rotation is due (zero: never)
+	closed   bool
+
+	signals chan os.Signal
+}
+
+// CreateRotatingWriter returns the writer for the file (appending to it, if it exists).
+func CreateRotatingWriter(fileName string, opts RotateOptions) *RotatingWriter {
+	if opts.Keep <= 0 {
+		opts.Keep = defaultKeep
+	}
+	w := &RotatingWriter{
+		name: fileName,
+		opts: opts,
+		now:  time.Now,
+	}
+	if opts.OnSignal {
+		w.signals = make(chan os.Signal, 1)
+		signal.Notify(w.signals, syscall.SIGHUP)
+		go w.follow(w.signals)
+	}
+	return w
+}
+
+func (w *RotatingWriter) follow(signals chan os.Signal) {
+	for range signals {
+		if err := w.Rotate(); err != nil {
+			onError("failed to rotate [%s], due to: %v", w.name, err)
+		}
+	}
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.guard.Lock()
+	defer w.guard.Unlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("write to closed file [%s]", w.name)
+	}
+
+	if w.file != nil {
+		due := !w.deadline.IsZero() && !w.now().Before(w.deadline)
+		full := w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize
+		if due || full {
+			if err := w.rotate(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file and moves it to the first generation; the next write starts a new file.
+// Nothing happens if nothing was written since the last rotation.
+func (w *RotatingWriter) Rotate() error {
+	w.guard.Lock()
+	defer w.guard.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.rotate()
+}
+
+// Close closes the file (it is not rotated).
+func (w *RotatingWriter) Close() error {
+	w.guard.Lock()
+	defer w.guard.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.signals != nil {
+		signal.Stop(w.signals)
+		close(w.signals)
+	}
+	if w.file != nil {
+		err := w.file.Close()
+		w.file = nil
+		return err
+	}
+	return nil
+}
+
+func (w *RotatingWriter) open() error {
+	// unlike CreateWriter (which truncates), the file is appended to: a restarted process
+	// must not lose the log written before, the size limit counts it in
+	file, err := os.OpenFile(w.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		onError("failed to create file [%s], due to: %v", w.name, err)
+		return err
+	}
+	w.size = 0
+	if info, err := file.Stat(); err == nil {
+		w.size = info.Size()
+	}
+	w.file = file
+	w.deadline = time.Time{}
+	if w.opts.Every > 0 {
+		w.deadline = nextBoundary(w.now(), w.opts.Every)
+	}
+	return nil
+}
+
+// nextBoundary returns the end of the period the time falls in, on the local wall clock: days end
+// at local midnight and the periods dividing a day are counted from it (so Hourly rotates on the
+// hour in the zones with a half-hour offset too). Other periods are counted from the zero time.
+func nextBoundary(now time.Time, every time.Duration) time.Time {
+	year, month, day := now.Date()
+	if every == Daily {
+		return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	}
+	if every < Daily && Daily%every == 0 {
+		hour, minute, second := now.Clock()
+		elapsed := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+			time.Duration(second)*time.Second + time.Duration(now.Nanosecond())
+		next := elapsed.Truncate(every) + every
+		return time.Date(year, month, day, 0, 0, 0, int(next), now.Location())
+	}
+	return now.Truncate(every).Add(every)
+}
+
+// rotate shifts the generations (the caller holds the guard and the file is open).
+func (w *RotatingWriter) rotate() error {
+	err := w.file.Close()
+	w.file, w.size = nil, 0
+	if err != nil {
+		return err
+	}
+
+	for _, ext := range []string{"", compressedExt} {
+		os.Remove(w.generation(w.opts.Keep) + ext)
+	}
+	for i := w.opts.Keep - 1; i >= 1; i-- {
+		for _, ext := range []string{"", compressedExt} {
+			if _, err := os.Stat(w.generation(i) + ext); err == nil {
+				if err := os.Rename(w.generation(i)+ext, w.generation(i+1)+ext); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	first := w.generation(1)
+	if err := os.Rename(w.name, first); err != nil {
+		return err
+	}
+	if w.opts.Compress {
+		// the rotation is done: a failure leaves the generation uncompressed, the write goes on
+		if err := compressFile(first); err != nil {
+			onError("failed to compress [%s], due to: %v", first, err)
+		}
+	}
+	return nil
+}
+
+func (w *RotatingWriter) generation(i int) string {
+	return w.name + "." + strconv.Itoa(i)
+}
+
+// compressFile replaces the file with its gzip-ed copy (name.gz), streaming it through.
+func compressFile(name string) error {
+	source, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	w, err := CreateAtomicWriter(name+compressedExt, rotatedLogPerm)
+	if err != nil {
+		return err
+	}
+	compressor, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err == nil {
+		if _, err = io.Copy(compressor, source); err == nil {
+			err = compressor.Close()
+		}
+	}
+	if err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seamia/libs/zip"
+)
+
+func TestRotatingWriterSize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w := CreateRotatingWriter(name, RotateOptions{MaxSize: 10, Keep: 2})
+	defer w.Close()
+
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatal("the file was created before the first write")
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{name: "fourth\n", name + ".1": "third\n", name + ".2": "second\n"} {
+		if content, _ := os.ReadFile(file); string(content) != want {
+			t.Errorf("%s: got %q, want %q", filepath.Base(file), content, want)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Error("more generations were kept than asked for")
+	}
+}
+
+func TestRotatingWriterCompressAndTime(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w := CreateRotatingWriter(name, RotateOptions{Every: Hourly, Compress: true})
+	defer w.Close()
+
+	clock := time.Date(2025, 3, 1, 10, 59, 0, 0, time.UTC)
+	w.now = func() time.Time { return clock }
+
+	w.Write([]byte("ten o'clock\n"))
+	clock = clock.Add(2 * time.Minute)
+	w.Write([]byte("eleven o'clock\n"))
+
+	raw, err := os.ReadFile(name + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := zip.Decompress(raw); err != nil || string(content) != "ten o'clock\n" {
+		t.Fatalf("unexpected rotated content %q (%v)", content, err)
+	}
+
+	// nothing was written since: no empty generation
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name + ".3.gz"); !os.IsNotExist(err) {
+		t.Fatal("an empty file was rotated")
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatal("the file was re-created without a write")
+	}
+}
+
+func TestRotatingWriterCompressFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	w := CreateRotatingWriter(name, RotateOptions{MaxSize: 10, Keep: 1, Compress: true})
+	defer w.Close()
+
+	// a directory in the way of the compressed generation
+	if err := os.MkdirAll(filepath.Join(name+".1.gz", "taken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n"} {
+		if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("the write failed along with the compression: %d (%v)", n, err)
+		}
+	}
+	if content, _ := os.ReadFile(name + ".1"); string(content) != "first\n" {
+		t.Errorf("the rotated generation was lost: %q", content)
+	}
+	if content, _ := os.ReadFile(name); string(content) != "second\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestNextBoundary(t *testing.T) {
+	india := time.FixedZone("IST", 5*3600+1800)
+	nepal := time.FixedZone("NPT", 5*3600+2700)
+	for _, test := range []struct {
+		now, want time.Time
+		every     time.Duration
+	}{
+		{time.Date(2025, 3, 1, 10, 59, 0, 0, time.UTC), time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC), Hourly},
+		{time.Date(2025, 3, 1, 10, 59, 0, 0, india), time.Date(2025, 3, 1, 11, 0, 0, 0, india), Hourly},
+		{time.Date(2025, 3, 1, 11, 0, 0, 0, india), time.Date(2025, 3, 1, 12, 0, 0, 0, india), Hourly},
+		{time.Date(2025, 3, 1, 23, 50, 0, 0, nepal), time.Date(2025, 3, 2, 0, 0, 0, 0, nepal), 15 * time.Minute},
+		{time.Date(2025, 3, 1, 10, 59, 0, 0, nepal), time.Date(2025, 3, 1, 12, 0, 0, 0, nepal), 6 * time.Hour},
+		{time.Date(2025, 3, 1, 23, 59, 0, 0, india), time.Date(2025, 3, 2, 0, 0, 0, 0, india), Daily},
+	} {
+		if got := nextBoundary(test.now, test.every); !got.Equal(test.want) {
+			t.Errorf("%v every %v: got %v, want %v", test.now, test.every, got, test.want)
+		}
+	}
+}
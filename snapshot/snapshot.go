@@ -11,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/seamia/libs/iox"
 	prn "github.com/seamia/libs/printer"
 	"github.com/seamia/libs/zip"
 )
@@ -98,7 +99,7 @@ func (snap *Snapshot) Save(name string) error {
 		if compressPersistedState {
 			raw = zip.Compress(raw)
 		}
-		err = ioutil.WriteFile(folder+name+".state", raw, 0644)
+		err = iox.WriteFileAtomic(folder+name+".state", raw, 0644)
 		return err
 	} else {
 		return err
@@ -0,0 +1,125 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	keyAtomic       = "atomic" // "no" makes uploads write directly into the destination file
+	extensionFsync  = "fsync@openssh.com"
+	tempFilePrefix  = "."
+	tempFilePostfix = ".upload-"
+)
+
+// remoteWriter writes a remote file; in atomic mode it writes a hidden temp file
+// in the same directory, which replaces the target only once it is complete.
+type remoteWriter struct {
+	conn   *Connection
+	client *sftp.Client
+	*sftp.File
+	target string // resolved destination path
+	temp   string // resolved temp path (empty in non-atomic mode)
+}
+
+func (c *Connection) atomic() bool {
+	return c.value(keyAtomic) != "no"
+}
+
+// createWriter starts writing the remote file (atomically, unless disabled for the connection).
+func (c *Connection) createWriter(dstPath string) (*remoteWriter, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &remoteWriter{conn: c, client: client, target: c.remotePath(dstPath)}
+	name := writer.target
+	if c.atomic() {
+		var random [6]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			return nil, err
+		}
+		dir, base := path.Split(writer.target)
+		writer.temp = path.Join(dir, tempFilePrefix+base+tempFilePostfix+hex.EncodeToString(random[:]))
+		name = writer.temp
+	}
+
+	if writer.File, err = client.Create(name); err != nil {
+		return nil, err
+	}
+	if err := writer.keepMode(); err != nil {
+		writer.abort()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// keepMode gives the temp file the mode of the file it is to replace (as writing
+// the file in place would keep it); a new file keeps the default mode.
+func (w *remoteWriter) keepMode() error {
+	if len(w.temp) == 0 {
+		return nil
+	}
+	info, err := w.client.Stat(w.target)
+	if err != nil {
+		return nil
+	}
+	return w.File.Chmod(info.Mode().Perm())
+}
+
+// commit makes sure all the expected bytes made it to the remote file and
+// (in atomic mode) renames the temp file over the target.
+func (w *remoteWriter) commit(expected int64) error {
+	if _, supported := w.client.HasExtension(extensionFsync); supported {
+		if err := w.File.Sync(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	if err := w.File.Close(); err != nil {
+		w.abort()
+		return err
+	}
+	if len(w.temp) == 0 {
+		return nil
+	}
+
+	info, err := w.client.Stat(w.temp)
+	if err == nil && info.Size() != expected {
+		err = fmt.Errorf("incomplete upload of (%s): %d of %d bytes", w.target, info.Size(), expected)
+	}
+	if err == nil {
+		if _, supported := w.client.HasExtension(extensionPosixRename); supported {
+			err = w.client.PosixRename(w.temp, w.target)
+		} else {
+			// plain sftp rename does not replace an existing file
+			if _, statErr := w.client.Stat(w.target); statErr == nil {
+				_ = w.client.Remove(w.target)
+			}
+			err = w.client.Rename(w.temp, w.target)
+		}
+	}
+	if err != nil {
+		w.abort()
+	}
+	return err
+}
+
+// abort closes and removes the temp file (the target is left intact).
+func (w *remoteWriter) abort() {
+	w.File.Close()
+	if len(w.temp) > 0 {
+		if err := w.client.Remove(w.temp); err != nil {
+			w.conn.printf("failed to remove temp file (%s): %v\n", w.temp, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	keyAuth          = "auth"           // ordered list of the methods to try, e.g. "agent,key,keyboard-interactive"
+	keyKey           = "key"            // private key file
+	keyCertificate   = "certificate"    // OpenSSH certificate for the key (defaults to <key>-cert.pub, if present)
+	keyPassphrase    = "passphrase"     // passphrase of the key (prefer passphrase.env or SetPassphraseCallback)
+	keyPassphraseEnv = "passphrase.env" // name of the env var holding the passphrase of the key
+	keyPassword      = "password"
+	keyAgent         = "agent" // path of the agent socket (defaults to $SSH_AUTH_SOCK)
+
+	authAgent               = "agent"
+	authKey                 = "key"
+	authPassword            = "password"
+	authKeyboardInteractive = "keyboard-interactive"
+
+	envAuthSock = "SSH_AUTH_SOCK"
+)
+
+// the order of the methods when the connection does not specify one
+var defaultAuthOrder = []string{authKey, authAgent, authPassword, authKeyboardInteractive}
+
+type (
+	// PassphraseCallback returns the passphrase of an encrypted private key file.
+	PassphraseCallback func(keyFile string) ([]byte, error)
+)
+
+var (
+	passphraseCallback     PassphraseCallback
+	keyboardInteractive    ssh.KeyboardInteractiveChallenge
+	authCallbacksGuard     sync.Mutex
+	errNoPassphrase        = errors.New("the key is encrypted, but no passphrase was provided")
+	errNoAuthMethodFound   = errors.New("no auth method found")
+	errUnknownAuthMethod   = errors.New("unknown auth method")
+	errAuthMethodNotUsable = errors.New("auth method is not configured")
+)
+
+// SetPassphraseCallback sets the callback used to obtain the passphrases of encrypted keys
+// (when neither `passphrase` nor `passphrase.env` is set for the connection).
+func SetPassphraseCallback(callback PassphraseCallback) {
+	authCallbacksGuard.Lock()
+	defer authCallbacksGuard.Unlock()
+	passphraseCallback = callback
+}
+
+// SetKeyboardInteractive sets the handler of keyboard-interactive challenges; without one,
+// the `password` of the connection is given as the answer to every question.
+func SetKeyboardInteractive(challenge ssh.KeyboardInteractiveChallenge) {
+	authCallbacksGuard.Lock()
+	defer authCallbacksGuard.Unlock()
+	keyboardInteractive = challenge
+}
+
+// authMethods builds the auth methods of the connection in the order they are to be tried.
+func (c *Connection) authMethods() ([]ssh.AuthMethod, error) {
+	order := defaultAuthOrder
+	explicit := len(c.value(keyAuth)) > 0
+	if explicit {
+		order = splitList(c.value(keyAuth))
+	}
+
+	var methods []ssh.AuthMethod
+	for _, name := range order {
+		method, err := c.authMethod(name)
+		if errors.Is(err, errNoPassphrase) && !explicit {
+			// the agent (next in the order) usually holds the decrypted key
+			err = fmt.Errorf("%w: %v", errAuthMethodNotUsable, err)
+		}
+		if err == nil {
+			c.printf("using %s based auth\n", name)
+			methods = append(methods, method)
+			continue
+		}
+		if errors.Is(err, errAuthMethodNotUsable) && !explicit {
+			c.printf("skipping %s based auth: %v\n", name, err)
+			continue
+		}
+		onError("error setting up %s auth: %v", name, err)
+		return nil, err
+	}
+
+	if len(methods) == 0 {
+		return nil, errNoAuthMethodFound
+	}
+	return methods, nil
+}
+
+func (c *Connection) authMethod(name string) (ssh.AuthMethod, error) {
+	switch name {
+	case authKey:
+		keyFileName := c.value(keyKey)
+		if len(keyFileName) == 0 {
+			return nil, fmt.Errorf("%w: missing `%s`", errAuthMethodNotUsable, keyKey)
+		}
+		signer, err := c.signerFromKey(expandHome(keyFileName))
+		if err != nil {
+			onError("error loading key: %v", err)
+			return nil, err
+		}
+		return ssh.PublicKeys(signer), nil
+
+	case authAgent:
+		socket := c.value(keyAgent)
+		if len(socket) == 0 {
+			socket = os.Getenv(envAuthSock)
+		}
+		if len(socket) == 0 {
+			return nil, fmt.Errorf("%w: no agent socket (%s)", errAuthMethodNotUsable, envAuthSock)
+		}
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			// a stale socket (cron, CI) only matters when the agent is asked for explicitly
+			return nil, fmt.Errorf("%w: failed to reach the agent (%s): %v", errAuthMethodNotUsable, socket, err)
+		}
+		c.agentConn = conn
+		return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+
+	case authPassword:
+		password := c.value(keyPassword)
+		if len(password) == 0 {
+			return nil, fmt.Errorf("%w: missing `%s`", errAuthMethodNotUsable, keyPassword)
+		}
+		return ssh.Password(password), nil
+
+	case authKeyboardInteractive:
+		authCallbacksGuard.Lock()
+		challenge := keyboardInteractive
+		authCallbacksGuard.Unlock()
+		if challenge != nil {
+			return ssh.KeyboardInteractive(challenge), nil
+		}
+
+		password := c.value(keyPassword)
+		if len(password) == 0 {
+			return nil, fmt.Errorf("%w: missing `%s` (or a handler)", errAuthMethodNotUsable, keyPassword)
+		}
+		return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range questions {
+				answers[i] = password
+			}
+			return answers, nil
+		}), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errUnknownAuthMethod, name)
+}
+
+// signerFromKey loads the private key (decrypting it if needed) along with its certificate (if any).
+func (c *Connection) signerFromKey(keyFileName string) (ssh.Signer, error) {
+	// Load private key
+	key, err := os.ReadFile(keyFileName)
+	if err != nil {
+		onError("unable to read private key: %v", err)
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, perr := c.passphrase(keyFileName)
+		if perr != nil {
+			return nil, fmt.Errorf("%s: %w", keyFileName, perr)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+	if err != nil {
+		onError("unable to parse private key: %v", err)
+		return nil, err
+	}
+
+	certFileName := c.value(keyCertificate)
+	if len(certFileName) == 0 {
+		certFileName = keyFileName + "-cert.pub"
+		if _, err := os.Stat(certFileName); err != nil {
+			return signer, nil
+		}
+	}
+
+	raw, err := os.ReadFile(expandHome(certFileName))
+	if err != nil {
+		return nil, err
+	}
+	public, _, _, _, err := ssh.ParseAuthorizedKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate (%s): %w", certFileName, err)
+	}
+	cert, ok := public.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("(%s) is not a certificate", certFileName)
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+func (c *Connection) passphrase(keyFileName string) ([]byte, error) {
+	if passphrase := c.value(keyPassphrase); len(passphrase) > 0 {
+		return []byte(passphrase), nil
+	}
+	if name := c.value(keyPassphraseEnv); len(name) > 0 {
+		if passphrase, found := os.LookupEnv(name); found {
+			return []byte(passphrase), nil
+		}
+		return nil, fmt.Errorf("env var (%s) with the passphrase is not set", name)
+	}
+
+	authCallbacksGuard.Lock()
+	callback := passphraseCallback
+	authCallbacksGuard.Unlock()
+	if callback != nil {
+		return callback(keyFileName)
+	}
+	return nil, errNoPassphrase
+}
@@ -0,0 +1,329 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	keyJump    = "jump"    // name of the ssh.info entry to reach the host through (the entry may have its own jump)
+	keyProxy   = "proxy"   // socks5://[user:password@]host:port or http://[user:password@]host:port
+	keyTimeout = "timeout" // dial timeout (e.g. "10s")
+
+	defaultDialTimeout = 30 * time.Second
+)
+
+// dial establishes the ssh connection to the host: directly, through a proxy or through the jump host.
+// Every hop is a connection of its own, with its own auth and host-key checks.
+func (c *Connection) dial(config *ssh.ClientConfig) (*ssh.Client, error) {
+	addr := c.value("address")
+	jump, proxy := c.value(keyJump), c.value(keyProxy)
+	if len(jump) > 0 && len(proxy) > 0 {
+		return nil, fmt.Errorf("both (%s) and (%s) are specified for %s: the proxy belongs to the jump host", keyJump, keyProxy, addr)
+	}
+
+	var conn net.Conn
+	var err error
+	switch {
+	case len(jump) > 0:
+		conn, err = c.dialJump(jump, addr, config.Timeout)
+	case len(proxy) > 0:
+		conn, err = dialProxy(proxy, addr, config.Timeout)
+	default:
+		return ssh.Dial("tcp", addr, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return handshake(conn, addr, config)
+}
+
+// handshake establishes the ssh connection over the (proxied or jumped) conn, within the timeout
+// of the config. The channels of a jump host do not support deadlines: they are closed instead.
+func handshake(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	var expired atomic.Bool
+	if config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(config.Timeout)); err == nil {
+			defer conn.SetDeadline(time.Time{})
+		} else {
+			timer := time.AfterFunc(config.Timeout, func() {
+				expired.Store(true)
+				conn.Close()
+			})
+			defer timer.Stop()
+		}
+	}
+
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if expired.Load() {
+			return nil, fmt.Errorf("ssh handshake with %s timed out after %v: %w", addr, config.Timeout, err)
+		}
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// jumpHost looks up and acquires the jump host of the connection (nil if it has none).
+// It runs before the guard of the connection is taken: the registry lock is never taken under a guard.
+func (c *Connection) jumpHost() (*Connection, error) {
+	name := c.value(keyJump)
+	if len(name) == 0 {
+		return nil, nil
+	}
+	if err := checkJumpChain(c, name); err != nil {
+		return nil, err
+	}
+	via, err := getConnection(name)
+	if err != nil {
+		return nil, fmt.Errorf("jump host (%s): %w", name, err)
+	}
+	return via, nil
+}
+
+// dialJump opens a tcp channel to the address through the jump host (acquired by jumpHost).
+// The jump host stays in use as long as this connection is open.
+func (c *Connection) dialJump(name, addr string, timeout time.Duration) (net.Conn, error) {
+	if c.via == nil {
+		return nil, fmt.Errorf("jump host (%s): %w", name, errNotConnected)
+	}
+	// the jump host was just acquired: it is not reconnected here, under the guard
+	client, err := c.via.connected()
+	if err != nil {
+		return nil, fmt.Errorf("jump host (%s): %w", name, err)
+	}
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s through jump host (%s): %w", addr, name, err)
+	}
+	return conn, nil
+}
+
+// checkJumpChain makes sure the chain of jump hosts ends (a loop would never connect).
+func checkJumpChain(from *Connection, name string) error {
+	seen := map[*Connection]bool{from: true}
+	for len(name) > 0 {
+		hop, err := lookupConnection(name)
+		if err != nil {
+			return fmt.Errorf("jump host: %w", err)
+		}
+		if seen[hop] {
+			return fmt.Errorf("jump host (%s) loops back", name)
+		}
+		seen[hop] = true
+		name = hop.Info[keyJump]
+	}
+	return nil
+}
+
+// dialProxy connects to the address through the SOCKS5 or HTTP CONNECT proxy.
+func dialProxy(proxy, addr string, timeout time.Duration) (net.Conn, error) {
+	where, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy (%s): %w", proxy, err)
+	}
+
+	var handshake func(conn net.Conn, where *url.URL, addr string) error
+	port := ""
+	switch where.Scheme {
+	case "socks5", "socks5h":
+		handshake, port = socksConnect, "1080"
+	case "http":
+		handshake, port = httpConnect, "8080"
+	default:
+		return nil, fmt.Errorf("unsupported proxy (%s): expected socks5:// or http://", proxy)
+	}
+	host := where.Host
+	if len(where.Port()) == 0 {
+		host = net.JoinHostPort(where.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := handshake(conn, where, addr); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy (%s): %w", where.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks the HTTP proxy for a tunnel to the address.
+func httpConnect(conn net.Conn, where *url.URL, addr string) error {
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if where.User != nil {
+		password, _ := where.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(where.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := request.Write(conn); err != nil {
+		return err
+	}
+
+	// the reader must not read past the response: whatever follows belongs to the ssh handshake
+	response, err := http.ReadResponse(bufio.NewReaderSize(&oneByteReader{conn}, 1), request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT %s: %s", addr, response.Status)
+	}
+	return nil
+}
+
+// oneByteReader keeps bufio from buffering more than the proxy response.
+type oneByteReader struct {
+	conn net.Conn
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.conn.Read(p)
+}
+
+const (
+	socksVersion      = 5
+	socksNoAuth       = 0
+	socksPassword     = 2
+	socksNoAcceptable = 0xff
+	socksConnectCmd   = 1
+	socksDomain       = 3
+	socksIPv4         = 1
+	socksIPv6         = 4
+)
+
+// socksConnect performs the SOCKS5 handshake (RFC 1928/1929) for the address.
+func socksConnect(conn net.Conn, where *url.URL, addr string) error {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || port <= 0 || port > 0xffff {
+		return fmt.Errorf("invalid port in (%s)", addr)
+	}
+	if len(host) > 255 {
+		return errors.New("host name is too long")
+	}
+
+	methods := []byte{socksVersion, 1, socksNoAuth}
+	if where.User != nil {
+		methods = []byte{socksVersion, 2, socksNoAuth, socksPassword}
+	}
+	if _, err := conn.Write(methods); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("unexpected socks version (%d)", reply[0])
+	}
+
+	switch reply[1] {
+	case socksNoAuth:
+	case socksPassword:
+		if where.User == nil {
+			return errors.New("socks proxy requires a user and password")
+		}
+		user := where.User.Username()
+		password, _ := where.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("socks user or password is too long")
+		}
+		auth := []byte{1, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("socks authentication failed")
+		}
+	case socksNoAcceptable:
+		return errors.New("no acceptable socks authentication method")
+	default:
+		return fmt.Errorf("unsupported socks authentication method (%d)", reply[1])
+	}
+
+	request := []byte{socksVersion, socksConnectCmd, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(append(request, socksIPv4), ip.To4()...)
+	} else if ip != nil {
+		request = append(append(request, socksIPv6), ip.To16()...)
+	} else {
+		request = append(append(request, socksDomain, byte(len(host))), host...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("socks connect to %s failed (code %d)", addr, header[1])
+	}
+	skip := 0
+	switch header[3] {
+	case socksIPv4:
+		skip = net.IPv4len
+	case socksIPv6:
+		skip = net.IPv6len
+	case socksDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return err
+		}
+		skip = int(size[0])
+	default:
+		return fmt.Errorf("unexpected socks address type (%d)", header[3])
+	}
+	// the bound address and port are not used
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
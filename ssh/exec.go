@@ -0,0 +1,177 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultTerm        = "xterm"
+	defaultTermWidth   = 80
+	defaultTermHeight  = 24
+	defaultSignalGrace = 5 * time.Second
+)
+
+// envName matches the names a shell accepts in an export (the fallback of withEnv).
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type (
+	// RunOptions control the execution of a remote command.
+	RunOptions struct {
+		Env    map[string]string // set via the session, or exported by the command when the server refuses them (names must be shell identifiers)
+		Stdin  io.Reader
+		Stdout io.Writer
+		Stderr io.Writer // ignored with a PTY (the output is merged into Stdout)
+
+		PTY    bool   // allocate a pseudo terminal
+		Term   string // terminal type (xterm by default)
+		Width  int    // terminal size (80x24 by default)
+		Height int
+
+		// Signal is sent to the remote process when the context is cancelled (TERM by default);
+		// if the process is still running after Grace (5s by default), the session is closed.
+		Signal ssh.Signal
+		Grace  time.Duration
+	}
+
+	// RunResult holds the outcome of a remote command.
+	RunResult struct {
+		Stdout   []byte
+		Stderr   []byte
+		ExitCode int
+	}
+)
+
+// Run executes the command on the remote host and collects its output.
+// A non-zero exit status is reported both in the result and as an *ssh.ExitError.
+func (c *Connection) Run(ctx context.Context, command string) (*RunResult, error) {
+	var stdout, stderr bytes.Buffer
+	code, err := c.Stream(ctx, command, RunOptions{Stdout: &stdout, Stderr: &stderr})
+	return &RunResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: code}, err
+}
+
+// Stream executes the command on the remote host, piping its output into the writers
+// of the options as it is produced, and returns its exit status.
+func (c *Connection) Stream(ctx context.Context, command string, opts RunOptions) (int, error) {
+	for name := range opts.Env {
+		if !envName.MatchString(name) {
+			return -1, fmt.Errorf("invalid env var name (%s)", name)
+		}
+	}
+	client, err := c.remote()
+	if err != nil {
+		return -1, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+
+	command = withEnv(session, command, opts.Env)
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if opts.PTY {
+		term, width, height := opts.Term, opts.Width, opts.Height
+		if len(term) == 0 {
+			term = defaultTerm
+		}
+		if width <= 0 || height <= 0 {
+			width, height = defaultTermWidth, defaultTermHeight
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(term, height, width, modes); err != nil {
+			return -1, err
+		}
+	}
+
+	c.printf("running: %s\n", command)
+	if err := session.Start(command); err != nil {
+		return -1, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		signal, grace := opts.Signal, opts.Grace
+		if len(signal) == 0 {
+			signal = ssh.SIGTERM
+		}
+		if grace <= 0 {
+			grace = defaultSignalGrace
+		}
+		_ = session.Signal(signal)
+		select {
+		case <-done:
+		case <-time.After(grace):
+			session.Close()
+			<-done
+		}
+		return -1, ctx.Err()
+	}
+
+	return exitCode(err)
+}
+
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), err
+	}
+	return -1, err
+}
+
+// withEnv sets the variables on the session; the ones the server refuses
+// (see AcceptEnv of sshd) are exported by the command itself.
+func withEnv(session *ssh.Session, command string, env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var exports []string
+	for _, name := range names {
+		if err := session.Setenv(name, env[name]); err != nil {
+			exports = append(exports, name+"="+shellQuote(env[name]))
+		}
+	}
+	if len(exports) == 0 {
+		return command
+	}
+	return "export " + strings.Join(exports, " ") + "; " + command
+}
+
+// Run executes the command on the host of the named connection.
+func Run(ctx context.Context, name, command string) (*RunResult, error) {
+	conn, err := getConnection(name)
+	if err != nil {
+		onError("error connecting to ssh (%s): %v", name, err)
+		return nil, err
+	}
+	defer conn.Release()
+	return conn.Run(ctx, command)
+}
@@ -0,0 +1,279 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+const extensionPosixRename = "posix-rename@openssh.com"
+
+var errNotConnected = errors.New("ssh: not connected")
+
+// Address is a "name:path" location: a path on the host of the named connection,
+// or a local path when there is no name.
+type Address struct {
+	Name string // connection name (empty for local paths)
+	Path string
+}
+
+// ParseAddress splits "name:path" into its parts. Anything without a colon,
+// and Windows paths such as `C:\dir`, are local paths.
+func ParseAddress(location string) Address {
+	at := strings.Index(location, ":")
+	if at <= 0 {
+		return Address{Path: location}
+	}
+	if at == 1 && len(location) > 2 && (location[2] == '\\' || location[2] == '/') {
+		// a drive letter
+		return Address{Path: location}
+	}
+	return Address{Name: location[:at], Path: location[at+1:]}
+}
+
+func (a Address) Remote() bool {
+	return len(a.Name) > 0
+}
+
+func (a Address) String() string {
+	if a.Remote() {
+		return a.Name + ":" + a.Path
+	}
+	return a.Path
+}
+
+// GetConnection returns the (connected) connection with the given name.
+// The connection is kept open (unless broken) until the caller calls Release.
+func GetConnection(name string) (*Connection, error) {
+	return getConnection(name)
+}
+
+// remotePath prefixes relative paths with the `root` of the connection.
+func (c *Connection) remotePath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		// we have an absolute path - no need to prefix any "root"
+		if root := c.value("root"); len(root) != 0 {
+			path = filepath.Join(root, path)
+		}
+	}
+	return strings.ReplaceAll(path, "\\", "/")
+}
+
+func (c *Connection) CreateFile(dstPath string) (*sftp.File, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	// Create the destination file
+	return client.Create(c.remotePath(dstPath))
+}
+
+// OpenFile opens the remote file for reading.
+func (c *Connection) OpenFile(srcPath string) (*sftp.File, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(c.remotePath(srcPath))
+}
+
+// Upload copies the local file to the remote path, returning the number of bytes copied.
+// The transfer options (resume, parallel, chunk.size) come from ssh.info.
+func (c *Connection) Upload(localPath, remotePath string) (int64, error) {
+	return c.UploadWith(localPath, remotePath, c.transferOptions())
+}
+
+// Download copies the remote file to the local path, returning the number of bytes copied.
+func (c *Connection) Download(remotePath, localPath string) (int64, error) {
+	srcFile, err := c.OpenFile(remotePath)
+	if err != nil {
+		onError("error opening source file (%s): %v", remotePath, err)
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(localPath)
+	if err != nil {
+		onError("error creating destination file (%s): %v", localPath, err)
+		return 0, err
+	}
+
+	copied, err := srcFile.WriteTo(dstFile)
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		onError("error copying file: %v", err)
+	}
+	return copied, err
+}
+
+func (c *Connection) ReadDir(path string) ([]os.FileInfo, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.ReadDir(c.remotePath(path))
+}
+
+func (c *Connection) Stat(path string) (os.FileInfo, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.Stat(c.remotePath(path))
+}
+
+// Remove removes a file or an empty directory.
+func (c *Connection) Remove(path string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Remove(c.remotePath(path))
+}
+
+// Rename renames (moves) the remote file, replacing the target if the server allows it.
+func (c *Connection) Rename(oldPath, newPath string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	oldPath, newPath = c.remotePath(oldPath), c.remotePath(newPath)
+	if _, supported := client.HasExtension(extensionPosixRename); supported {
+		return client.PosixRename(oldPath, newPath)
+	}
+	return client.Rename(oldPath, newPath)
+}
+
+func (c *Connection) MkdirAll(path string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.MkdirAll(c.remotePath(path))
+}
+
+func (c *Connection) Chmod(path string, mode os.FileMode) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Chmod(c.remotePath(path), mode)
+}
+
+// copyRemote copies a file between two remote locations (possibly on different hosts).
+func copyRemote(from *Connection, srcPath string, to *Connection, dstPath string) (int64, error) {
+	srcFile, err := from.OpenFile(srcPath)
+	if err != nil {
+		onError("error opening source file (%s): %v", srcPath, err)
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	dstFile, err := to.createWriter(dstPath)
+	if err != nil {
+		onError("error creating destination file (%s): %v", dstPath, err)
+		return 0, err
+	}
+
+	copied, err := io.Copy(dstFile, srcFile)
+	if err == nil && copied != info.Size() {
+		err = fmt.Errorf("copied %d of %d bytes", copied, info.Size())
+	}
+	if err != nil {
+		dstFile.abort()
+		onError("error copying file: %v", err)
+		return copied, err
+	}
+	if err = dstFile.commit(copied); err != nil {
+		onError("error completing file (%s): %v", dstPath, err)
+	}
+	return copied, err
+}
+
+// CopyFile copies a file; either side (or both) may be a "name:path" remote location,
+// e.g. CopyFile("app.log", "host:/var/log/app.log") or CopyFile("host:/var/log/app.log", "app.log").
+func CopyFile(srcPath, dstPath string) error {
+
+	var (
+		conn        *Connection
+		err         error
+		bytesCopied int64
+	)
+
+	{
+		start := time.Now()
+		defer func() {
+			took := time.Since(start)
+			if conn != nil {
+				var rate float64 = float64(bytesCopied) / took.Seconds()
+				conn.printf("SSHCopyFile: took %s to complete (rate: %v; bytes: %v)\n", took, int64(rate), bytesCopied)
+			}
+		}()
+	}
+
+	src, dst := ParseAddress(srcPath), ParseAddress(dstPath)
+	switch {
+	case src.Remote() && dst.Remote():
+		var srcConn *Connection
+		if srcConn, err = getConnection(src.Name); err != nil {
+			onError("error connecting to ssh (%s): %v", src.Name, err)
+			return err
+		}
+		defer srcConn.Release()
+		conn, err = withConnection(dst.Name, func(dstConn *Connection) (err error) {
+			bytesCopied, err = copyRemote(srcConn, src.Path, dstConn, dst.Path)
+			return err
+		})
+	case src.Remote():
+		conn, err = withConnection(src.Name, func(srcConn *Connection) (err error) {
+			bytesCopied, err = srcConn.Download(src.Path, dst.Path)
+			return err
+		})
+	case dst.Remote():
+		conn, err = withConnection(dst.Name, func(dstConn *Connection) (err error) {
+			bytesCopied, err = dstConn.Upload(src.Path, dst.Path)
+			return err
+		})
+	default:
+		return fmt.Errorf("incorrect destination: %v (neither side is remote)", dstPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Connection) Chtimes(path string, atime, mtime time.Time) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Chtimes(c.remotePath(path), atime, mtime)
+}
+
+// RemoveAll removes the path and everything below it.
+func (c *Connection) RemoveAll(path string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.RemoveAll(c.remotePath(path))
+}
@@ -0,0 +1,216 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const defaultLocalAddr = "127.0.0.1:0"
+
+// Forward is a port forwarding (see ForwardLocal and ForwardRemote). It is ready to accept
+// connections as soon as it is returned; it runs until Close (or until its listener fails, see Done).
+type Forward struct {
+	listener net.Listener
+	dial     func() (net.Conn, error)
+	release  func()
+	done     chan struct{}
+
+	lock   sync.Mutex // guards the fields below
+	conns  map[net.Conn]bool
+	err    error
+	closed bool
+}
+
+// ForwardLocal listens on the local address (127.0.0.1:0, i.e. a random port, when empty) and forwards
+// every connection to the remote address through the named connection (see Connection.ForwardLocal).
+func ForwardLocal(name, localAddr, remoteAddr string) (*Forward, error) {
+	return forwardNamed(name, func(conn *Connection) (*Forward, error) {
+		return conn.ForwardLocal(localAddr, remoteAddr)
+	})
+}
+
+// ForwardRemote listens on the remote address (on the host of the named connection) and forwards
+// every connection to the local address (see Connection.ForwardRemote).
+func ForwardRemote(name, remoteAddr, localAddr string) (*Forward, error) {
+	return forwardNamed(name, func(conn *Connection) (*Forward, error) {
+		return conn.ForwardRemote(remoteAddr, localAddr)
+	})
+}
+
+// forwardNamed keeps the connection in use until the forwarding is closed.
+func forwardNamed(name string, start func(conn *Connection) (*Forward, error)) (*Forward, error) {
+	conn, err := getConnection(name)
+	if err != nil {
+		onError("error connecting to ssh (%s): %v", name, err)
+		return nil, err
+	}
+	forward, err := start(conn)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	forward.release = conn.Release
+	return forward, nil
+}
+
+// ForwardLocal listens on the local address and forwards every connection to the remote address
+// (as seen from the host); the connections are dialed over the current ssh client, so the forwarding
+// survives reconnects.
+func (c *Connection) ForwardLocal(localAddr, remoteAddr string) (*Forward, error) {
+	if len(localAddr) == 0 {
+		localAddr = defaultLocalAddr
+	}
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return c.forward(listener, func() (net.Conn, error) {
+		client, err := c.remote()
+		if err != nil {
+			return nil, err
+		}
+		return client.Dial("tcp", remoteAddr)
+	}), nil
+}
+
+// ForwardRemote asks the host to listen on the remote address and forwards every connection
+// to the local address. The listener belongs to the ssh client: it stops if the connection breaks.
+func (c *Connection) ForwardRemote(remoteAddr, localAddr string) (*Forward, error) {
+	client, err := c.remote()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	return c.forward(listener, func() (net.Conn, error) {
+		return net.Dial("tcp", localAddr)
+	}), nil
+}
+
+func (c *Connection) forward(listener net.Listener, dial func() (net.Conn, error)) *Forward {
+	f := &Forward{
+		listener: listener,
+		dial:     dial,
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]bool),
+	}
+	go f.serve(c)
+	return f
+}
+
+// Addr returns the address the forwarding listens on (e.g. the random port picked for 127.0.0.1:0).
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Done is closed when the forwarding stops.
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the reason the forwarding stopped (nil after Close).
+func (f *Forward) Err() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.err
+}
+
+// Close stops the forwarding and drops the connections it carries.
+func (f *Forward) Close() error {
+	f.lock.Lock()
+	if f.closed {
+		f.lock.Unlock()
+		return nil
+	}
+	f.closed = true
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.lock.Unlock()
+
+	err := f.listener.Close()
+	<-f.done
+	if f.release != nil {
+		f.release()
+	}
+	return err
+}
+
+func (f *Forward) serve(c *Connection) {
+	defer close(f.done)
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			f.lock.Lock()
+			if !f.closed {
+				f.err = err
+				c.printf("forwarding on %v stopped: %v\n", f.listener.Addr(), err)
+			}
+			f.lock.Unlock()
+			return
+		}
+		go f.pipe(c, conn)
+	}
+}
+
+// track remembers the connection so Close can drop it (false once the forwarding is closed).
+func (f *Forward) track(conn net.Conn) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = true
+	return true
+}
+
+func (f *Forward) forget(conn net.Conn) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.conns, conn)
+}
+
+func (f *Forward) pipe(c *Connection, incoming net.Conn) {
+	defer incoming.Close()
+	if !f.track(incoming) {
+		return
+	}
+	defer f.forget(incoming)
+
+	outgoing, err := f.dial()
+	if err != nil {
+		onError("error forwarding connection from %v: %v", incoming.RemoteAddr(), err)
+		return
+	}
+	defer outgoing.Close()
+	if !f.track(outgoing) {
+		return
+	}
+	defer f.forget(outgoing)
+
+	var wait sync.WaitGroup
+	wait.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wait.Done()
+		if _, err := io.Copy(dst, src); err != nil && !errors.Is(err, net.ErrClosed) {
+			c.printf("forwarding %v: %v\n", incoming.RemoteAddr(), err)
+		}
+		// let the other side know there is nothing more to come
+		if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+			closer.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go copyHalf(outgoing, incoming)
+	go copyHalf(incoming, outgoing)
+	wait.Wait()
+}
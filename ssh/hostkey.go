@@ -0,0 +1,229 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	keyKnownHosts    = "known_hosts"    // additional known_hosts file(s) for the connection (comma separated)
+	keyFingerprint   = "fingerprint"    // pinned host key fingerprint(s), e.g. "SHA256:..." (comma separated)
+	keyHostKeyCheck  = "host.key.check" // "yes" (default) or "accept-new" to trust (and record) a host seen for the first time
+	hostKeyAcceptNew = "accept-new"
+)
+
+// known_hosts files are appended to by several connections
+var knownHostsGuard sync.Mutex
+
+// HostKeyError is returned when the host presents a key that is not known
+// (or does not match the known/pinned one).
+type HostKeyError struct {
+	Host        string   // host name as dialed
+	Remote      net.Addr // actual remote address
+	Fingerprint string   // SHA256 fingerprint of the presented key
+	Want        []string // fingerprints on record (empty when the host is unknown)
+}
+
+func (e *HostKeyError) Error() string {
+	if len(e.Want) == 0 {
+		return fmt.Sprintf("ssh: unknown host key for %s (%s); add it to known_hosts or pin its fingerprint", e.Host, e.Fingerprint)
+	}
+	return fmt.Sprintf("ssh: host key mismatch for %s: got %s, expected %s (possible man-in-the-middle attack)",
+		e.Host, e.Fingerprint, strings.Join(e.Want, " or "))
+}
+
+// Unknown reports whether the host had no key on record at all.
+func (e *HostKeyError) Unknown() bool {
+	return len(e.Want) == 0
+}
+
+func defaultKnownHosts() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".ssh", "known_hosts")
+	}
+	return ""
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// knownHostsFiles returns the known_hosts files of the connection followed by ~/.ssh/known_hosts.
+func (c *Connection) knownHostsFiles() []string {
+	files := splitList(c.value(keyKnownHosts))
+	for i, name := range files {
+		files[i] = expandHome(name)
+	}
+	if name := defaultKnownHosts(); len(name) > 0 {
+		files = append(files, name)
+	}
+	return files
+}
+
+func expandHome(name string) string {
+	if strings.HasPrefix(name, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, name[2:])
+		}
+	}
+	return name
+}
+
+// hostKeyCallback verifies the host key against the pinned fingerprints (if any),
+// or against the known_hosts files. The returned algorithms (if any) are the key types
+// on record for the host, so the server is asked for a key that can actually be verified.
+func (c *Connection) hostKeyCallback() (ssh.HostKeyCallback, []string, error) {
+	if pinned := splitList(c.value(keyFingerprint)); len(pinned) > 0 {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			c.printHostKey(hostname, remote, key)
+			fingerprint := ssh.FingerprintSHA256(key)
+			for _, want := range pinned {
+				if want == fingerprint || want == "MD5:"+ssh.FingerprintLegacyMD5(key) {
+					return nil
+				}
+			}
+			return &HostKeyError{Host: hostname, Remote: remote, Fingerprint: fingerprint, Want: pinned}
+		}, nil, nil
+	}
+
+	var existing []string
+	for _, name := range c.knownHostsFiles() {
+		if _, err := os.Stat(name); err == nil {
+			existing = append(existing, name)
+		}
+	}
+
+	check := func(string, net.Addr, ssh.PublicKey) error {
+		return &knownhosts.KeyError{}
+	}
+	if len(existing) > 0 {
+		var err error
+		if check, err = knownhosts.New(existing...); err != nil {
+			onError("error reading known_hosts (%s): %v", strings.Join(existing, ", "), err)
+			return nil, nil, err
+		}
+	}
+
+	acceptNew := c.value(keyHostKeyCheck) == hostKeyAcceptNew
+	callback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		c.printHostKey(hostname, remote, key)
+
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+
+		failure := &HostKeyError{Host: hostname, Remote: remote, Fingerprint: ssh.FingerprintSHA256(key)}
+		for _, known := range keyErr.Want {
+			failure.Want = append(failure.Want, ssh.FingerprintSHA256(known.Key))
+		}
+		if failure.Unknown() && acceptNew {
+			return c.rememberHostKey(hostname, remote, key)
+		}
+		return failure
+	}
+
+	return callback, c.knownAlgorithms(check), nil
+}
+
+// knownAlgorithms asks the known_hosts callback which keys are on record for the address.
+func (c *Connection) knownAlgorithms(check ssh.HostKeyCallback) []string {
+	address := c.value("address")
+	remote, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		remote = &net.TCPAddr{}
+	}
+
+	// a key that can not be on record makes the callback list the ones that are
+	probe := &probeKey{}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(address, remote, probe), &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		for _, algorithm := range hostKeyAlgorithms(known.Key.Type()) {
+			if !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// hostKeyAlgorithms maps a key type to the signature algorithms a server may use with it.
+func hostKeyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// rememberHostKey records the key of a host seen for the first time (trust on first use).
+func (c *Connection) rememberHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	name := defaultKnownHosts()
+	if files := splitList(c.value(keyKnownHosts)); len(files) > 0 {
+		name = expandHome(files[0])
+	}
+	if len(name) == 0 {
+		return errors.New("ssh: no known_hosts file to record the host key in")
+	}
+
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil {
+		if normalized := knownhosts.Normalize(remote.String()); normalized != addresses[0] {
+			addresses = append(addresses, normalized)
+		}
+	}
+
+	knownHostsGuard.Lock()
+	defer knownHostsGuard.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c.printf("recording host key %s for %s in %s\n", ssh.FingerprintSHA256(key), hostname, name)
+	_, err = fmt.Fprintln(file, knownhosts.Line(addresses, key))
+	return err
+}
+
+func (c *Connection) printHostKey(hostname string, remote net.Addr, key ssh.PublicKey) {
+	c.printf("hostname: %v\n", hostname)
+	c.printf("remote:   %v\n", remote)
+	c.printf("key:      %v %v\n", key.Type(), ssh.FingerprintSHA256(key))
+}
+
+// probeKey is a key of a type no host has
+type probeKey struct{}
+
+func (probeKey) Type() string                                 { return "probe" }
+func (probeKey) Marshal() []byte                              { return []byte("probe") }
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error { return errors.New("probe") }
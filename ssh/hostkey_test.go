@@ -0,0 +1,116 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seamia/libs/ssh"
+	"github.com/seamia/libs/ssh/sshtest"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHostsEntry registers the server checked against a known_hosts file (instead of the pinned fingerprint).
+func knownHostsEntry(t *testing.T, server *sshtest.Server, knownHosts string, extra ssh.Dict) string {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir()) // keeps ~/.ssh/known_hosts out of the way
+
+	info := server.Dict()
+	delete(info, "fingerprint")
+	info["known_hosts"] = knownHosts
+	for k, v := range extra {
+		info[k] = v
+	}
+	name := t.Name()
+	if err := ssh.Register(name, info); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ssh.CloseAll)
+	return name
+}
+
+func writeKnownHosts(t *testing.T, address string, key xssh.PublicKey) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "known_hosts")
+	content := ""
+	if key != nil {
+		content = knownhosts.Line([]string{knownhosts.Normalize(address)}, key) + "\n"
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestKnownHostsMatch(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := knownHostsEntry(t, server, writeKnownHosts(t, server.Addr, server.HostKey.PublicKey()), nil)
+
+	conn, err := ssh.GetConnection(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+}
+
+func TestKnownHostsMismatch(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	other := sshtest.NewServer(t, sshtest.Options{})
+	name := knownHostsEntry(t, server, writeKnownHosts(t, server.Addr, other.HostKey.PublicKey()), nil)
+
+	_, err := ssh.GetConnection(name)
+	var hostKeyErr *ssh.HostKeyError
+	if !errors.As(err, &hostKeyErr) || hostKeyErr.Unknown() {
+		t.Fatalf("expected a host key mismatch, got %v", err)
+	}
+	if hostKeyErr.Want[0] != xssh.FingerprintSHA256(other.HostKey.PublicKey()) {
+		t.Fatalf("unexpected key on record: %v", hostKeyErr.Want)
+	}
+}
+
+func TestKnownHostsUnknown(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := knownHostsEntry(t, server, writeKnownHosts(t, server.Addr, nil), nil)
+
+	_, err := ssh.GetConnection(name)
+	var hostKeyErr *ssh.HostKeyError
+	if !errors.As(err, &hostKeyErr) || !hostKeyErr.Unknown() {
+		t.Fatalf("expected an unknown host, got %v", err)
+	}
+}
+
+func TestKnownHostsAcceptNew(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	knownHosts := writeKnownHosts(t, server.Addr, nil)
+	name := knownHostsEntry(t, server, knownHosts, ssh.Dict{"host.key.check": "accept-new"})
+
+	conn, err := ssh.GetConnection(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+
+	content, err := os.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := knownhosts.Line([]string{knownhosts.Normalize(server.Addr)}, server.HostKey.PublicKey())
+	if strings.TrimSpace(string(content)) != want {
+		t.Fatalf("known_hosts has %q, want %q", content, want)
+	}
+
+	// the recorded key is now enforced
+	ssh.CloseAll()
+	strict := knownHostsEntry(t, server, knownHosts, nil)
+	if conn, err = ssh.GetConnection(strict); err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+}
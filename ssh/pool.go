@@ -0,0 +1,261 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	keyAutoClose   = "auto.close"   // "yes" closes the connection as soon as it is not in use
+	keyKeepalive   = "keepalive"    // interval of keepalive requests ("30s" by default, "0" disables them)
+	keyIdleTimeout = "idle.timeout" // closes the connection after it was not used for that long (e.g. "5m")
+
+	defaultKeepalive = 30 * time.Second
+	keepaliveRequest = "keepalive@openssh.com"
+)
+
+func (c *Connection) duration(key string, fallback time.Duration) time.Duration {
+	if value := c.value(key); len(value) > 0 {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		onError("invalid duration (%s) for (%s)", value, key)
+	}
+	return fallback
+}
+
+// acquire connects (or reconnects) the connection and marks it as being in use.
+func (c *Connection) acquire() error {
+	via, err := c.jumpHost()
+	if err != nil {
+		return err
+	}
+	c.guard.Lock()
+	defer c.guard.Unlock()
+
+	if err := c.ensureConnected(via); err != nil {
+		return err
+	}
+	c.users++
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// Release marks the connection (obtained with GetConnection) as no longer used by the caller.
+func (c *Connection) Release() {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+
+	if c.users > 0 {
+		c.users--
+	}
+	c.lastUsed = time.Now()
+	if c.users == 0 && c.flag(keyAutoClose) {
+		c.disconnect()
+	}
+}
+
+// ensureConnected re-establishes a connection that was closed or broken (the caller holds the guard).
+// via is the jump host obtained with jumpHost: a new connection keeps it, otherwise it is released.
+func (c *Connection) ensureConnected(via *Connection) error {
+	if c.dead {
+		c.printf("reconnecting to %s\n", c.value("address"))
+		c.disconnect()
+	}
+	if c.sftpClient != nil {
+		if via != nil {
+			via.Release()
+		}
+		return nil
+	}
+	c.via = via
+	return c.connect()
+}
+
+// client returns the sftp client (reconnecting if needed).
+func (c *Connection) client() (*sftp.Client, error) {
+	via, err := c.jumpHost()
+	if err != nil {
+		return nil, err
+	}
+	c.guard.Lock()
+	defer c.guard.Unlock()
+
+	if err := c.ensureConnected(via); err != nil {
+		return nil, err
+	}
+	c.lastUsed = time.Now()
+	return c.sftpClient, nil
+}
+
+// remote returns the ssh client (reconnecting if needed).
+func (c *Connection) remote() (*ssh.Client, error) {
+	via, err := c.jumpHost()
+	if err != nil {
+		return nil, err
+	}
+	c.guard.Lock()
+	defer c.guard.Unlock()
+
+	if err := c.ensureConnected(via); err != nil {
+		return nil, err
+	}
+	c.lastUsed = time.Now()
+	return c.sshClient, nil
+}
+
+// connected returns the ssh client of an established connection (without reconnecting).
+func (c *Connection) connected() (*ssh.Client, error) {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+
+	if c.sshClient == nil || c.dead {
+		return nil, errNotConnected
+	}
+	return c.sshClient, nil
+}
+
+// maintain watches the ssh client: it notices when the connection goes away, sends the keepalives
+// and closes the connection once it is idle for too long.
+func (c *Connection) maintain(client *ssh.Client, stop chan struct{}) {
+	gone := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(gone)
+	}()
+
+	keepalive := c.duration(keyKeepalive, defaultKeepalive)
+	idle := c.duration(keyIdleTimeout, 0)
+	tick := keepalive
+	if tick <= 0 || (idle > 0 && idle < tick) {
+		tick = idle
+	}
+
+	var ticks <-chan time.Time
+	if tick > 0 {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	lastKeepalive := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-gone:
+			c.markDead(client)
+			return
+
+		case now := <-ticks:
+			if idle > 0 && c.closeIfIdle(client, idle) {
+				return
+			}
+			if keepalive > 0 && now.Sub(lastKeepalive) >= keepalive {
+				lastKeepalive = now
+				if err := sendKeepalive(client, keepalive); err != nil {
+					c.printf("keepalive to %s failed: %v\n", c.value("address"), err)
+					client.Close()
+					c.markDead(client)
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendKeepalive sends a keepalive request, giving up after the timeout.
+func sendKeepalive(client *ssh.Client, timeout time.Duration) error {
+	reply := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest(keepaliveRequest, true, nil)
+		reply <- err
+	}()
+	select {
+	case err := <-reply:
+		return err
+	case <-time.After(timeout):
+		return errors.New("keepalive timed out")
+	}
+}
+
+func (c *Connection) markDead(client *ssh.Client) {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	if c.sshClient == client {
+		c.dead = true
+	}
+}
+
+func (c *Connection) closeIfIdle(client *ssh.Client, idle time.Duration) bool {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	if c.sshClient != client || c.users > 0 || time.Since(c.lastUsed) < idle {
+		return false
+	}
+	c.printf("closing idle connection to %s\n", c.value("address"))
+	c.disconnect()
+	return true
+}
+
+// lost reports whether the error means the connection went away (so the operation may be retried).
+func (c *Connection) lost(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errNotConnected) {
+		return true
+	}
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	return c.dead
+}
+
+// withConnection runs the operation on the named connection, reconnecting and
+// retrying once if the connection turns out to be broken.
+func withConnection(name string, operation func(conn *Connection) error) (*Connection, error) {
+	conn, err := getConnection(name)
+	if err != nil {
+		onError("error connecting to ssh (%s): %v", name, err)
+		return nil, err
+	}
+	defer conn.Release()
+
+	conn.guard.Lock()
+	client := conn.sshClient
+	conn.guard.Unlock()
+
+	if err = operation(conn); conn.lost(err) {
+		conn.printf("connection to %s lost (%v), retrying\n", conn.value("address"), err)
+		// a concurrent retry may have reconnected already: only the client used here is dead
+		conn.markDead(client)
+		err = operation(conn)
+	}
+	return conn, err
+}
+
+// CloseAll closes every open connection (e.g. on shutdown); they reconnect if used again.
+func CloseAll() {
+	knownConnetionsGuard.Lock()
+	conns := make([]*Connection, 0, len(knownConnetions))
+	for _, conn := range knownConnetions {
+		conns = append(conns, conn)
+	}
+	knownConnetionsGuard.Unlock()
+
+	// closed outside of the registry lock: closing takes the guard of the connection
+	for _, conn := range conns {
+		conn.close()
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	keyAddress = "address" // host:port
+	keyUser    = "user"
+
+	infoFileName  = "ssh.info"
+	defaultPort   = "22"
+	sshConfigNone = "none"
+)
+
+// InfoError is returned for the connection settings that cannot work (e.g. a missing `address`).
+type InfoError struct {
+	Name   string // connection name
+	Key    string // offending key
+	Reason string
+}
+
+func (e *InfoError) Error() string {
+	return fmt.Sprintf("ssh: connection (%s): %s (%s)", e.Name, e.Reason, e.Key)
+}
+
+// validate checks the settings of the connection before anything is dialed.
+func validate(name string, info Dict) error {
+	for _, key := range []string{keyAddress, keyUser} {
+		if len(info[key]) == 0 {
+			return &InfoError{Name: name, Key: key, Reason: "missing value"}
+		}
+	}
+	if _, port, err := net.SplitHostPort(info[keyAddress]); err != nil || len(port) == 0 {
+		return &InfoError{Name: name, Key: keyAddress, Reason: "expected host:port"}
+	}
+	if info[keyJump] == name {
+		return &InfoError{Name: name, Key: keyJump, Reason: "the connection cannot jump through itself"}
+	}
+	if len(info[keyJump]) > 0 && len(info[keyProxy]) > 0 {
+		return &InfoError{Name: name, Key: keyProxy, Reason: "the proxy belongs to the jump host"}
+	}
+	return nil
+}
+
+var (
+	defaultsLoaded     bool             // ssh.info and ~/.ssh/config were read
+	invalidConnections map[string]error // entries of the files that failed the validation
+)
+
+// Register adds (or replaces) the connection with the given name.
+func Register(name string, info Dict) error {
+	if err := validate(name, info); err != nil {
+		return err
+	}
+	knownConnetionsGuard.Lock()
+	old := register(name, info)
+	knownConnetionsGuard.Unlock()
+
+	// closed outside of the registry lock: closing takes the guard of the connection
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// register stores the connection (the caller holds the guard) and returns the one it replaced (if any).
+func register(name string, info Dict) *Connection {
+	if knownConnetions == nil {
+		knownConnetions = make(map[string]*Connection)
+	}
+	old := knownConnetions[name]
+	delete(invalidConnections, name)
+
+	copied := make(Dict, len(info))
+	for k, v := range info {
+		copied[k] = v
+	}
+	knownConnetions[name] = &Connection{Info: copied}
+	return old
+}
+
+// LoadInfo reads the connections from the json file (in the ssh.info format);
+// they replace the connections registered under the same names.
+func LoadInfo(fileName string) error {
+	var params map[string]Dict
+	if err := jsonLoadUnmarshal(fileName, &params); err != nil {
+		return err
+	}
+
+	var problems []error
+	for name, info := range params {
+		if err := Register(name, info); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// LoadConfig reads the hosts of the OpenSSH config file (e.g. ~/.ssh/config); see parseConfig.
+// The hosts replace the connections registered under the same names.
+func LoadConfig(fileName string) error {
+	hosts, err := parseConfigFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var problems []error
+	for _, host := range hosts {
+		if err := Register(host.name, host.info); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// loadDefaults reads ./ssh.info (or ~/ssh.info) and then ~/.ssh/config, once (the caller holds the guard).
+// The connections registered explicitly are kept, ssh.info wins over ~/.ssh/config.
+func loadDefaults() error {
+	if defaultsLoaded {
+		return nil
+	}
+	defaultsLoaded = true
+	if knownConnetions == nil {
+		knownConnetions = make(map[string]*Connection)
+	}
+	invalidConnections = make(map[string]error)
+
+	add := func(name string, info Dict) {
+		if _, found := knownConnetions[name]; found {
+			return
+		}
+		if _, found := invalidConnections[name]; found {
+			return
+		}
+		if err := validate(name, info); err != nil {
+			invalidConnections[name] = err
+			return
+		}
+		register(name, info)
+	}
+
+	homeDir, homeErr := os.UserHomeDir()
+
+	infoFile := "./" + infoFileName
+	if _, err := os.Stat(infoFile); err != nil && homeErr == nil {
+		infoFile = filepath.Join(homeDir, infoFileName)
+	}
+	if raw, err := os.ReadFile(infoFile); err == nil {
+		var params map[string]Dict
+		if err := json.Unmarshal(raw, &params); err != nil {
+			onError("error getting ssh info: %v (%s)", err, infoFile)
+			return err
+		}
+		for name, info := range params {
+			add(name, info)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		onError("error getting ssh info: %v (%s)", err, infoFile)
+		return err
+	}
+
+	if homeErr == nil {
+		configFile := filepath.Join(homeDir, ".ssh", "config")
+		hosts, err := parseConfigFile(configFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			onError("error reading ssh config: %v (%s)", err, configFile)
+			return err
+		}
+		for _, host := range hosts {
+			add(host.name, host.info)
+		}
+	}
+	return nil
+}
+
+func lookupConnection(key string) (*Connection, error) {
+	knownConnetionsGuard.Lock()
+	defer knownConnetionsGuard.Unlock()
+
+	if conn, found := knownConnetions[key]; found {
+		return conn, nil
+	}
+	if err := loadDefaults(); err != nil {
+		return nil, err
+	}
+	if conn, found := knownConnetions[key]; found {
+		return conn, nil
+	}
+	if err, found := invalidConnections[key]; found {
+		return nil, err
+	}
+	return nil, fmt.Errorf("unknown connection name [%s]", key)
+}
+
+type configBlock struct {
+	patterns []string
+	values   map[string]string // lower case keyword -> the first value
+}
+
+type configHost struct {
+	name string
+	info Dict
+}
+
+func parseConfigFile(fileName string) ([]configHost, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseConfig(bufio.NewScanner(file))
+}
+
+// parseConfig turns the (non wildcard) Host entries of an OpenSSH config into connections:
+// HostName and Port make the `address`, User the `user`, the first IdentityFile the `key`
+// and ProxyJump the `jump`. As with OpenSSH, the first value found for a host wins
+// (so `Host *` defaults go at the end); Match blocks are skipped.
+func parseConfig(scanner *bufio.Scanner) ([]configHost, error) {
+	var blocks []*configBlock
+	var current *configBlock
+	var aliases []string
+	skipping := false
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		keyword, value := splitConfigLine(text)
+		if len(value) == 0 {
+			return nil, fmt.Errorf("ssh config: line %d: missing value for (%s)", line, keyword)
+		}
+
+		switch keyword {
+		case "host":
+			current = &configBlock{patterns: strings.Fields(value), values: make(map[string]string)}
+			blocks = append(blocks, current)
+			skipping = false
+			for _, pattern := range current.patterns {
+				if !strings.ContainsAny(pattern, "*?!") {
+					aliases = append(aliases, pattern)
+				}
+			}
+			continue
+		case "match":
+			skipping = true
+			continue
+		}
+		if skipping {
+			continue
+		}
+		if current == nil {
+			// the values before the first Host apply to every host
+			current = &configBlock{patterns: []string{"*"}, values: make(map[string]string)}
+			blocks = append(blocks, current)
+		}
+		if _, found := current.values[keyword]; !found {
+			current.values[keyword] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var hosts []configHost
+	seen := make(map[string]bool)
+	for _, alias := range aliases {
+		if seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		// resolved first: the hops of its ProxyJump are appended to hosts before the host itself
+		host := resolveConfigHost(alias, blocks, seen, &hosts)
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func splitConfigLine(text string) (string, string) {
+	keyword, value, found := strings.Cut(text, "=")
+	if space := strings.IndexAny(text, " \t"); !found || (space >= 0 && space < len(keyword)) {
+		keyword, value, _ = strings.Cut(strings.Replace(text, "\t", " ", 1), " ")
+		value = strings.TrimPrefix(strings.TrimSpace(value), "=")
+	}
+	return strings.ToLower(strings.TrimSpace(keyword)), unquoteConfig(strings.TrimSpace(value))
+}
+
+func unquoteConfig(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// resolveConfigHost collects the values of the alias from the matching blocks.
+// The hops of ProxyJump become connections of their own: a chain "a,b" is reached through
+// the connection "a,b", which is b jumping through a (and a can be user@host:port).
+func resolveConfigHost(alias string, blocks []*configBlock, seen map[string]bool, hosts *[]configHost) configHost {
+	values := make(map[string]string)
+	for _, block := range blocks {
+		if !matchHost(alias, block.patterns) {
+			continue
+		}
+		for keyword, value := range block.values {
+			if _, found := values[keyword]; !found {
+				values[keyword] = value
+			}
+		}
+	}
+
+	hostName := alias
+	if name := values["hostname"]; len(name) > 0 {
+		hostName = strings.ReplaceAll(name, "%h", alias)
+	}
+	port := defaultPort
+	if value := values["port"]; len(value) > 0 {
+		port = value
+	}
+	info := Dict{keyAddress: net.JoinHostPort(hostName, port)}
+	if user := values["user"]; len(user) > 0 {
+		info[keyUser] = user
+	} else if user := os.Getenv("USER"); len(user) > 0 {
+		info[keyUser] = user
+	}
+	if key := values["identityfile"]; len(key) > 0 && key != sshConfigNone {
+		info[keyKey] = expandHome(key)
+	}
+
+	if jump := values["proxyjump"]; len(jump) > 0 && jump != sshConfigNone && hosts != nil {
+		hops := strings.Split(jump, ",")
+		previous := ""
+		for i := range hops {
+			hop := strings.TrimSpace(hops[i])
+			name := hop
+			if len(previous) > 0 {
+				name = previous + "," + hop
+			} else if isConfigAlias(hop, blocks) {
+				// the first hop is an ordinary host of the config
+				previous = name
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				var hopInfo Dict
+				if isConfigAlias(hop, blocks) {
+					// the hop's own ProxyJump is replaced by the chain
+					hopInfo = resolveConfigHost(hop, blocks, seen, nil).info
+				} else {
+					hopInfo = jumpHopInfo(hop)
+				}
+				delete(hopInfo, keyJump)
+				if len(previous) > 0 {
+					hopInfo[keyJump] = previous
+				}
+				*hosts = append(*hosts, configHost{name: name, info: hopInfo})
+			}
+			previous = name
+		}
+		info[keyJump] = previous
+	}
+	return configHost{name: alias, info: info}
+}
+
+func jumpHopInfo(hop string) Dict {
+	info := Dict{}
+	if user, rest, found := strings.Cut(hop, "@"); found {
+		info[keyUser], hop = user, rest
+	} else if user := os.Getenv("USER"); len(user) > 0 {
+		info[keyUser] = user
+	}
+	if _, _, err := net.SplitHostPort(hop); err != nil {
+		hop = net.JoinHostPort(hop, defaultPort)
+	}
+	info[keyAddress] = hop
+	return info
+}
+
+func isConfigAlias(name string, blocks []*configBlock) bool {
+	for _, block := range blocks {
+		for _, pattern := range block.patterns {
+			if pattern == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchHost applies the OpenSSH pattern list (with `!` negations) to the alias.
+func matchHost(alias string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if ok, _ := path.Match(pattern, alias); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
@@ -0,0 +1,124 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("USER", "me")
+
+	for _, test := range []struct {
+		name   string
+		config string
+		hosts  []configHost
+	}{
+		{
+			name: "host",
+			config: `
+				Host web
+					HostName 10.0.0.1
+					Port=2222
+					User deploy
+					IdentityFile ~/.ssh/web
+					IdentityFile ~/.ssh/other`,
+			hosts: []configHost{
+				{"web", Dict{"address": "10.0.0.1:2222", "user": "deploy", "key": "/home/me/.ssh/web"}},
+			},
+		},
+		{
+			name: "defaults",
+			config: `
+				Port 2200
+				Host a b
+					User first
+				Host a
+					User second
+				Match user root
+					User root
+				Host *
+					User fallback
+					HostName %h.example.com`,
+			hosts: []configHost{
+				{"a", Dict{"address": "a.example.com:2200", "user": "first"}},
+				{"b", Dict{"address": "b.example.com:2200", "user": "first"}},
+			},
+		},
+		{
+			name: "wildcards and none",
+			config: `
+				Host *.internal !skip.internal
+					ProxyJump none
+					IdentityFile none
+				Host app.internal`,
+			hosts: []configHost{
+				{"app.internal", Dict{"address": "app.internal:22", "user": "me"}},
+			},
+		},
+		{
+			name: "jump through an alias",
+			config: `
+				Host bastion
+					HostName bastion.example.com
+					ProxyJump gateway
+				Host db
+					ProxyJump bastion`,
+			hosts: []configHost{
+				{"gateway", Dict{"address": "gateway:22", "user": "me"}},
+				{"bastion", Dict{"address": "bastion.example.com:22", "user": "me", "jump": "gateway"}},
+				{"db", Dict{"address": "db:22", "user": "me", "jump": "bastion"}},
+			},
+		},
+		{
+			name: "jump chain",
+			config: `
+				Host db
+					ProxyJump ops@gw1:2022,gw2`,
+			hosts: []configHost{
+				{"ops@gw1:2022", Dict{"address": "gw1:2022", "user": "ops"}},
+				{"ops@gw1:2022,gw2", Dict{"address": "gw2:22", "user": "me", "jump": "ops@gw1:2022"}},
+				{"db", Dict{"address": "db:22", "user": "me", "jump": "ops@gw1:2022,gw2"}},
+			},
+		},
+		{
+			name: "jump chain of aliases",
+			config: `
+				Host bastion
+					HostName bastion.example.com
+				Host inner
+					HostName 10.1.0.1
+					User admin
+					ProxyJump elsewhere
+				Host db
+					ProxyJump bastion,inner`,
+			hosts: []configHost{
+				{"bastion", Dict{"address": "bastion.example.com:22", "user": "me"}},
+				{"elsewhere", Dict{"address": "elsewhere:22", "user": "me"}},
+				{"inner", Dict{"address": "10.1.0.1:22", "user": "admin", "jump": "elsewhere"}},
+				{"bastion,inner", Dict{"address": "10.1.0.1:22", "user": "admin", "jump": "bastion"}},
+				{"db", Dict{"address": "db:22", "user": "me", "jump": "bastion,inner"}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			hosts, err := parseConfig(bufio.NewScanner(strings.NewReader(test.config)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(hosts, test.hosts) {
+				t.Fatalf("unexpected hosts:\n%v\nexpected:\n%v", hosts, test.hosts)
+			}
+		})
+	}
+
+	if _, err := parseConfig(bufio.NewScanner(strings.NewReader("Host web\n  HostName\n"))); err == nil {
+		t.Fatal("expected a missing value to be reported")
+	}
+}
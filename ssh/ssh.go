@@ -5,14 +5,6 @@
 package ssh
 
 import (
-	"errors"
-	"fmt"
-	"net"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
-
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
@@ -38,17 +30,19 @@ func (c *Connection) printf(format string, args ...interface{}) {
 	}
 }
 
-// optional close (if parama call for it)
-func (c *Connection) optClose() {
-	if c.value("auto.close") == "yes" {
-		c.close()
-	}
-}
-
 func (c *Connection) close() {
-	knownConnetionsGuard.Lock()
-	defer knownConnetionsGuard.Unlock()
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	c.disconnect()
+}
 
+// disconnect releases whatever the connection holds (the caller holds the guard)
+func (c *Connection) disconnect() {
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	c.dead = false
 	if c.sftpClient != nil {
 		c.sftpClient.Close()
 		c.sftpClient = nil
@@ -57,47 +51,41 @@ func (c *Connection) close() {
 		c.sshClient.Close()
 		c.sshClient = nil
 	}
+	if c.agentConn != nil {
+		c.agentConn.Close()
+		c.agentConn = nil
+	}
+	if c.via != nil {
+		c.via.Release()
+		c.via = nil
+	}
 }
 
+// connect establishes the connection (the caller holds the guard)
 func (c *Connection) connect() error {
 	if c.sftpClient != nil {
 		// already connected
 		return nil
 	}
 
-	var method ssh.AuthMethod
-	var err error
-
-	if keyFileName := c.value("key"); len(keyFileName) != 0 {
-		c.printf("using key based auth\n")
-		method, err = getSignerFromKey(keyFileName)
-		if err != nil {
-			onError("error loading key: %v", err)
-			return err
-		}
-	} else if password := c.value("password"); len(password) != 0 {
-		c.printf("using password based auth\n")
-		method = ssh.Password(password)
-	} else {
-		return errors.New("no auth method found")
+	methods, err := c.authMethods()
+	if err != nil {
+		c.disconnect()
+		return err
 	}
 
-	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		// use OpenSSH's known_hosts file if you care about host validation
-
-		c.printf("hostname: %v\n", hostname)
-		c.printf("remote:   %v\n", remote)
-		c.printf("key:      %v\n", key.Type())
-
-		return nil
+	hostKeyCallback, hostKeyAlgorithms, err := c.hostKeyCallback()
+	if err != nil {
+		c.disconnect()
+		return err
 	}
 
 	config := &ssh.ClientConfig{
-		User: c.value("user"),
-		Auth: []ssh.AuthMethod{
-			method,
-		},
-		HostKeyCallback: hostKeyCallback, // ssh.InsecureIgnoreHostKey(),
+		User:              c.value("user"),
+		Auth:              methods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           c.duration(keyTimeout, defaultDialTimeout),
 	}
 
 	/*
@@ -109,9 +97,10 @@ func (c *Connection) connect() error {
 	*/
 
 	addr := c.value("address")
-	client, err := ssh.Dial("tcp", addr, config)
+	client, err := c.dial(config)
 	if err != nil {
 		onError("error connecting to ssh (%s): %v", addr, err)
+		c.disconnect()
 		return err
 	}
 	c.sshClient = client
@@ -120,140 +109,26 @@ func (c *Connection) connect() error {
 	sftp, err := sftp.NewClient(client)
 	if err != nil {
 		onError("error creating sftp client: %v", err)
+		c.disconnect()
 		return err
 	}
 	c.sftpClient = sftp
 
-	return nil
-}
+	c.stop = make(chan struct{})
+	go c.maintain(client, c.stop)
 
-func (c *Connection) CreateFile(dstPath string) (*sftp.File, error) {
-	if !strings.HasPrefix(dstPath, "/") {
-		// we have an absolute path - no need to prefix any "root"
-		if root := c.value("root"); len(root) != 0 {
-			dstPath = filepath.Join(root, dstPath)
-		}
-	}
-	dstPath = strings.ReplaceAll(dstPath, "\\", "/")
-
-	// Create the destination file
-	return c.sftpClient.Create(dstPath)
+	return nil
 }
 
+// getConnection returns the named connection, connected and marked as in use (see Release).
 func getConnection(key string) (*Connection, error) {
-	knownConnetionsGuard.Lock()
-	defer knownConnetionsGuard.Unlock()
-
-	if knownConnetions == nil {
-		var params map[string]Dict
-
-		localConfig := "./ssh.info"
-		err := jsonLoadUnmarshal(localConfig, &params)
-		if err != nil {
-
-			if homeDir, err := os.UserHomeDir(); err == nil {
-				homeBasedConfig := filepath.Join(homeDir, "ssh.info")
-				if err := jsonLoadUnmarshal(homeBasedConfig, &params); err != nil {
-					onError("error getting ssh info from home folder: %v (%s)", err, homeBasedConfig)
-					return nil, err
-				}
-			} else {
-				onError("error getting ssh info: %v (%s)", err, localConfig)
-				return nil, err
-			}
-		}
-
-		knownConnetions = make(map[string]*Connection)
-		for key, info := range params {
-			conn := &Connection{
-				Info: info,
-			}
-			knownConnetions[key] = conn
-		}
-	}
-
-	if conn, found := knownConnetions[key]; found {
-		if err := conn.connect(); err != nil {
-			onError("error connecting to ssh: %v", err)
-			return nil, err
-		}
-		return conn, nil
-	}
-
-	return nil, fmt.Errorf("unknown connection name [%s]", key)
-}
-
-func getSignerFromKey(keyFileName string) (ssh.AuthMethod, error) {
-	// Load private key
-	key, err := os.ReadFile(keyFileName)
+	conn, err := lookupConnection(key)
 	if err != nil {
-		onError("unable to read private key: %v", err)
 		return nil, err
 	}
-
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		onError("unable to parse private key: %v", err)
+	if err := conn.acquire(); err != nil {
+		onError("error connecting to ssh: %v", err)
 		return nil, err
 	}
-
-	return ssh.PublicKeys(signer), nil
-}
-
-func CopyFile(srcPath, dstPath string) error {
-
-	var (
-		conn        *Connection
-		err         error
-		bytesCopied int64
-	)
-
-	{
-		start := time.Now()
-		defer func() {
-			took := time.Since(start)
-			if conn != nil {
-				var rate float64 = float64(bytesCopied) / took.Seconds()
-				conn.printf("SSHCopyFile: took %s to complete (rate: %v; bytes: %v)\n", took, int64(rate), bytesCopied)
-			}
-		}()
-	}
-
-	dstParts := strings.Split(dstPath, ":")
-	if len(dstParts) != 2 {
-		return fmt.Errorf("incorrect destination: %v", dstPath)
-	}
-
-	dstKey := dstParts[0]
-	conn, err = getConnection(dstKey)
-	if err != nil {
-		onError("error connecting to ssh (%s): %v", dstKey, err)
-		return err
-	}
-
-	// Open the source file
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
-		onError("error opening source file (%s): %v", srcPath, err)
-		return err
-	}
-	defer srcFile.Close()
-
-	// Create the destination file
-	dstFile, err := conn.CreateFile(strings.Join(dstParts[1:], ":"))
-	if err != nil {
-		onError("error creating destination file (%s): %v", dstPath, err)
-		return err
-	}
-	defer dstFile.Close()
-
-	// write to file
-	if bytesCopied, err = dstFile.ReadFrom(srcFile); err != nil {
-		onError("error copying file: %v", err)
-		return err
-	}
-
-	conn.optClose()
-
-	return nil
+	return conn, nil
 }
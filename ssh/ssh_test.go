@@ -0,0 +1,549 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seamia/libs/ssh"
+	"github.com/seamia/libs/ssh/sshtest"
+	xssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func register(t *testing.T, server *sshtest.Server, extra ssh.Dict) string {
+	t.Helper()
+	info := server.Dict()
+	for k, v := range extra {
+		info[k] = v
+	}
+	name := t.Name()
+	if err := ssh.Register(name, info); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ssh.CloseAll)
+	return name
+}
+
+func localFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	name := filepath.Join(t.TempDir(), "local.bin")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name, data
+}
+
+func TestCopyFile(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 64*1024)
+	os.MkdirAll(filepath.Join(server.Root, "sub", "dir"), 0755)
+
+	if err := ssh.CopyFile(local, name+":sub/dir/remote.bin"); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := os.ReadFile(filepath.Join(server.Root, "sub", "dir", "remote.bin"))
+	if err != nil || !bytes.Equal(uploaded, data) {
+		t.Fatalf("uploaded file differs (%v)", err)
+	}
+
+	back := filepath.Join(t.TempDir(), "back.bin")
+	if err := ssh.CopyFile(name+":sub/dir/remote.bin", back); err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := os.ReadFile(back)
+	if err != nil || !bytes.Equal(downloaded, data) {
+		t.Fatalf("downloaded file differs (%v)", err)
+	}
+}
+
+func TestCopyFileReconnects(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 512*1024)
+
+	// the first connection breaks in the middle of the upload
+	server.SetFaults(sshtest.Faults{DropAfter: 128 * 1024, Connections: 1})
+	if err := ssh.CopyFile(local, name+":remote.bin"); err != nil {
+		t.Fatal(err)
+	}
+	uploaded, err := os.ReadFile(filepath.Join(server.Root, "remote.bin"))
+	if err != nil || !bytes.Equal(uploaded, data) {
+		t.Fatalf("uploaded file differs (%v)", err)
+	}
+}
+
+func TestCopyFileKeepsMode(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, _ := localFile(t, 1024)
+
+	for file, mode := range map[string]os.FileMode{"secret.bin": 0600, "tool.sh": 0755} {
+		remote := filepath.Join(server.Root, file)
+		if err := os.WriteFile(remote, []byte("old"), mode); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(remote, mode)
+		if err := ssh.CopyFile(local, name+":"+file); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Stat(remote); err != nil || info.Mode().Perm() != mode {
+			t.Errorf("%s: the mode was not kept: %v (%v)", file, info.Mode(), err)
+		}
+	}
+}
+
+func TestCopyFileConcurrent(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, _ := localFile(t, 64*1024)
+
+	var wait sync.WaitGroup
+	failures := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			if err := ssh.CopyFile(local, fmt.Sprintf("%s:copy-%d.bin", name, i)); err != nil {
+				failures <- err
+			}
+		}(i)
+	}
+	wait.Wait()
+	close(failures)
+	for err := range failures {
+		t.Error(err)
+	}
+}
+
+func TestCopyFileConcurrentReconnect(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 1024*1024)
+
+	// only the first connection breaks: every copy succeeds on the retry
+	server.SetFaults(sshtest.Faults{DropAfter: 256 * 1024, Connections: 1})
+	var wait sync.WaitGroup
+	failures := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			if err := ssh.CopyFile(local, fmt.Sprintf("%s:copy-%d.bin", name, i)); err != nil {
+				failures <- err
+			}
+		}(i)
+	}
+	wait.Wait()
+	close(failures)
+	for err := range failures {
+		t.Error(err)
+	}
+	for i := 0; i < 4; i++ {
+		if uploaded, _ := os.ReadFile(filepath.Join(server.Root, fmt.Sprintf("copy-%d.bin", i))); !bytes.Equal(uploaded, data) {
+			t.Errorf("copy-%d.bin differs", i)
+		}
+	}
+}
+
+func TestCopyFileFailure(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, _ := localFile(t, 512*1024)
+	if err := os.WriteFile(filepath.Join(server.Root, "remote.bin"), []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetFaults(sshtest.Faults{DropAfter: 128 * 1024})
+	if err := ssh.CopyFile(local, name+":remote.bin"); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	if content, _ := os.ReadFile(filepath.Join(server.Root, "remote.bin")); string(content) != "original" {
+		t.Fatalf("the destination was modified: %q", content)
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+
+	result, err := ssh.Run(context.Background(), name, "echo hello; echo oops >&2; exit 3")
+	if result == nil || result.ExitCode != 3 || string(result.Stdout) != "hello\n" || string(result.Stderr) != "oops\n" {
+		t.Fatalf("unexpected result: %+v (%v)", result, err)
+	}
+	if err == nil {
+		t.Fatal("expected an error for the non-zero exit status")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err := ssh.Run(ctx, name, "sleep 30"); err == nil {
+		t.Fatal("expected the cancelled command to fail")
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Fatal("the cancelled command was not stopped")
+	}
+}
+
+func TestRunEnv(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	conn, err := ssh.GetConnection(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	var stdout bytes.Buffer
+	env := map[string]string{"GREETING": "it's $HOME"}
+	if _, err := conn.Stream(context.Background(), `echo "$GREETING"`, ssh.RunOptions{Env: env, Stdout: &stdout}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "it's $HOME\n" {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+
+	for _, bad := range []string{"", "1ST", "A;touch injected", "A B", "A=B"} {
+		env := map[string]string{bad: "x"}
+		if _, err := conn.Stream(context.Background(), "true", ssh.RunOptions{Env: env}); err == nil {
+			t.Fatalf("expected (%s) to be rejected", bad)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, "injected")); !os.IsNotExist(err) {
+		t.Fatal("the env var name was executed")
+	}
+}
+
+func TestSync(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+
+	local := t.TempDir()
+	for file, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(local, file)), 0755)
+		os.WriteFile(filepath.Join(local, file), []byte(content), 0644)
+	}
+	os.MkdirAll(filepath.Join(server.Root, "site"), 0755)
+	os.WriteFile(filepath.Join(server.Root, "site", "stale.txt"), []byte("stale"), 0644)
+
+	if _, err := ssh.Sync(local, name+":site", ssh.SyncOptions{Checksum: true, Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(server.Root, "site", "sub", "b.txt")); string(content) != "b" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, "site", "stale.txt")); !os.IsNotExist(err) {
+		t.Fatal("stale file was not deleted")
+	}
+}
+
+func TestSyncMissingDir(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+
+	local := t.TempDir()
+	os.WriteFile(filepath.Join(local, "a.txt"), []byte("a"), 0644)
+
+	report, err := ssh.Sync(local, name+":fresh/site", ssh.SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Actions) != 2 || report.Actions[0].Op != ssh.SyncMkdir || report.Actions[0].Path != "." {
+		t.Fatalf("the missing directory was not reported: %v", report)
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, "fresh")); !os.IsNotExist(err) {
+		t.Fatal("the dry run created the directory")
+	}
+
+	if _, err := ssh.Sync(local, name+":fresh/site", ssh.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(server.Root, "fresh", "site", "a.txt")); string(content) != "a" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
+
+func TestHostKeyMismatch(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	other := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, ssh.Dict{"fingerprint": other.Dict()["fingerprint"]})
+
+	_, err := ssh.GetConnection(name)
+	var hostKeyErr *ssh.HostKeyError
+	if !errors.As(err, &hostKeyErr) || hostKeyErr.Unknown() {
+		t.Fatalf("expected a host key mismatch, got %v", err)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	err := ssh.Register("broken", ssh.Dict{"address": "example.com:22"})
+	var infoErr *ssh.InfoError
+	if !errors.As(err, &infoErr) || infoErr.Key != "user" {
+		t.Fatalf("expected a missing user, got %v", err)
+	}
+}
+
+func TestJumpHost(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	target := sshtest.NewServer(t, sshtest.Options{})
+	jump := register(t, bastion, nil) + "-bastion"
+	if err := ssh.Register(jump, bastion.Dict()); err != nil {
+		t.Fatal(err)
+	}
+	name := register(t, target, ssh.Dict{"jump": jump})
+
+	local, data := localFile(t, 64*1024)
+	if err := ssh.CopyFile(local, name+":remote.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(target.Root, "remote.bin")); !bytes.Equal(content, data) {
+		t.Fatal("file copied through the jump host differs")
+	}
+
+	// connecting through the jump host while the registry changes must not deadlock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wait sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wait.Add(2)
+			go func(i int) {
+				defer wait.Done()
+				ssh.CopyFile(local, fmt.Sprintf("%s:copy%d.bin", name, i))
+			}(i)
+			go func() {
+				defer wait.Done()
+				ssh.CloseAll()
+				ssh.Register(jump+"-other", bastion.Dict())
+			}()
+		}
+		wait.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("connecting through the jump host deadlocked")
+	}
+}
+
+func TestJumpHostTimeout(t *testing.T) {
+	bastion := sshtest.NewServer(t, sshtest.Options{})
+	jump := register(t, bastion, nil) + "-bastion"
+	if err := ssh.Register(jump, bastion.Dict()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the target accepts the connection but never says a word
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	info := bastion.Dict()
+	info["address"], info["jump"], info["timeout"] = listener.Addr().String(), jump, "300ms"
+	if err := ssh.Register(t.Name(), info); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if _, err := ssh.GetConnection(t.Name()); err == nil {
+		t.Fatal("expected the handshake to time out")
+	}
+	if time.Since(started) > 10*time.Second {
+		t.Fatal("the handshake through the jump host was not bounded")
+	}
+}
+
+func TestJumpHostLoop(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, ssh.Dict{"jump": t.Name() + "-back"})
+	back := server.Dict()
+	back["jump"] = name
+	if err := ssh.Register(t.Name()+"-back", back); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ssh.GetConnection(name); err == nil || !strings.Contains(err.Error(), "loops back") {
+		t.Fatalf("expected the loop to be reported, got %v", err)
+	}
+}
+
+// echoServer answers every connection with whatever it receives.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func roundTrip(t *testing.T, addr string) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("unexpected reply %q (%v)", reply, err)
+	}
+}
+
+func TestForwardLocal(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+
+	forward, err := ssh.ForwardLocal(name, "", echoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, forward.Addr().String())
+	roundTrip(t, forward.Addr().String())
+
+	if err := forward.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-forward.Done()
+	if _, err := net.Dial("tcp", forward.Addr().String()); err == nil {
+		t.Fatal("the forwarding still listens after Close")
+	}
+}
+
+func TestForwardRemote(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+
+	forward, err := ssh.ForwardRemote(name, "127.0.0.1:0", echoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forward.Close()
+	roundTrip(t, forward.Addr().String())
+}
+
+func TestStaleAgentSocket(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "gone.sock"))
+
+	// with the default order the agent is skipped and the key is used
+	info := server.Dict()
+	delete(info, "auth")
+	if err := ssh.Register(t.Name(), info); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ssh.CloseAll)
+	conn, err := ssh.GetConnection(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+
+	// the agent asked for explicitly must be reachable
+	name := register(t, server, ssh.Dict{"auth": "agent,key"})
+	if _, err := ssh.GetConnection(name); err == nil {
+		t.Fatal("expected the unreachable agent to fail the connection")
+	}
+}
+
+func TestEncryptedKeyWithAgent(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublic, _ := xssh.NewPublicKey(public)
+	server := sshtest.NewServer(t, sshtest.Options{Keys: []xssh.PublicKey{sshPublic}})
+
+	block, err := xssh.MarshalPrivateKeyWithPassphrase(private, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_encrypted")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent holds the decrypted key (a socket path must be short)
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	listener, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: private}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", listener.Addr().String())
+
+	info := server.Dict()
+	delete(info, "auth")
+	info["key"] = keyFile
+	if err := ssh.Register(t.Name(), info); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ssh.CloseAll)
+	conn, err := ssh.GetConnection(t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+}
@@ -0,0 +1,514 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sshtest provides an in-process SSH server (with the SFTP subsystem and command execution)
+// for testing the code that uses the ssh package without real hosts.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	libssh "github.com/seamia/libs/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultUser = "test"
+	waitDelay   = 100 * time.Millisecond
+)
+
+type (
+	// Options configure the server; the zero value is a server for user "test" with a generated key.
+	Options struct {
+		User     string          // "test" by default
+		Password string          // enables password auth (in addition to the key)
+		Keys     []ssh.PublicKey // additional keys accepted for the user
+		HostKey  ssh.Signer      // generated when nil
+		Faults   Faults
+	}
+
+	// Faults are injected into the connections accepted by the server.
+	Faults struct {
+		DropAfter   int64         // the server drops the connection after receiving that many bytes
+		SlowWrites  time.Duration // delay before every read of the data sent by the client (slows the uploads)
+		Connections int           // number of the (next) connections affected; 0 affects all of them
+	}
+
+	// Server is an SSH server listening on the loopback interface.
+	Server struct {
+		Root    string     // directory served over sftp (and the working directory of the commands)
+		Addr    string     // host:port the server listens on
+		User    string     // name of the user
+		KeyFile string     // private key of the user (accepted by the server)
+		HostKey ssh.Signer // key the server presents
+
+		password string
+		config   *ssh.ServerConfig
+		listener net.Listener
+
+		lock     sync.Mutex // guards the fields below
+		faults   Faults
+		affected int // number of the connections the faults were applied to
+		conns    map[net.Conn]bool
+		closed   bool
+	}
+)
+
+// NewServer starts the server serving a temporary directory; it is stopped when the test ends.
+func NewServer(tb testing.TB, opts Options) *Server {
+	tb.Helper()
+
+	server, err := start(tb.TempDir(), tb.TempDir(), opts)
+	if err != nil {
+		tb.Fatalf("sshtest: %v", err)
+	}
+	tb.Cleanup(func() { server.Close() })
+	return server
+}
+
+func start(root, keys string, opts Options) (*Server, error) {
+	s := &Server{
+		Root:     root,
+		User:     opts.User,
+		HostKey:  opts.HostKey,
+		password: opts.Password,
+		faults:   opts.Faults,
+		conns:    make(map[net.Conn]bool),
+	}
+	if len(s.User) == 0 {
+		s.User = defaultUser
+	}
+
+	if s.HostKey == nil {
+		signer, _, err := generateKey()
+		if err != nil {
+			return nil, err
+		}
+		s.HostKey = signer
+	}
+
+	userKey, pemBlock, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	s.KeyFile = filepath.Join(keys, "id_ed25519")
+	if err := os.WriteFile(s.KeyFile, pem.EncodeToMemory(pemBlock), 0600); err != nil {
+		return nil, err
+	}
+
+	accepted := append([]ssh.PublicKey{userKey.PublicKey()}, opts.Keys...)
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == s.User {
+				for _, known := range accepted {
+					if string(known.Marshal()) == string(key.Marshal()) {
+						return nil, nil
+					}
+				}
+			}
+			return nil, fmt.Errorf("sshtest: key rejected for (%s)", meta.User())
+		},
+	}
+	if len(s.password) > 0 {
+		s.config.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == s.User && string(password) == s.password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("sshtest: password rejected for (%s)", meta.User())
+		}
+	}
+	s.config.AddHostKey(s.HostKey)
+
+	if s.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, err
+	}
+	s.Addr = s.listener.Addr().String()
+	go s.serve()
+	return s, nil
+}
+
+func generateKey() (ssh.Signer, *pem.Block, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, block, nil
+}
+
+// Dict returns the settings for connecting to the server (see ssh.Register); the host key is pinned.
+func (s *Server) Dict() libssh.Dict {
+	info := libssh.Dict{
+		"address":     s.Addr,
+		"user":        s.User,
+		"key":         s.KeyFile,
+		"auth":        "key",
+		"fingerprint": ssh.FingerprintSHA256(s.HostKey.PublicKey()),
+		"root":        s.Root + "/",
+	}
+	if len(s.password) > 0 {
+		info["password"], info["auth"] = s.password, "key,password"
+	}
+	return info
+}
+
+// SetFaults changes the faults injected into the connections accepted from now on.
+func (s *Server) SetFaults(faults Faults) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults, s.affected = faults, 0
+}
+
+// Close stops the server and drops all its connections.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.lock.Unlock()
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// track registers the connection (wrapping it into the faults, if any).
+func (s *Server) track(conn net.Conn) (net.Conn, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	s.conns[conn] = true
+
+	faults := s.faults
+	if faults.Connections > 0 && s.affected >= faults.Connections {
+		return conn, true
+	}
+	if faults.DropAfter > 0 || faults.SlowWrites > 0 {
+		s.affected++
+		return &faultyConn{Conn: conn, faults: faults}, true
+	}
+	return conn, true
+}
+
+func (s *Server) forget(conn net.Conn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *Server) handle(raw net.Conn) {
+	defer raw.Close()
+	conn, ok := s.track(raw)
+	if !ok {
+		return
+	}
+	defer s.forget(raw)
+
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go s.globalRequests(serverConn, requests)
+
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "session":
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go s.session(channel, channelRequests)
+		case "direct-tcpip":
+			go directTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// session serves the sftp subsystem and the exec requests (run by `sh -c` in the root).
+func (s *Server) session(channel ssh.Channel, requests <-chan *ssh.Request) {
+	var env []string
+	var process *exec.Cmd
+	var guard sync.Mutex
+
+	for request := range requests {
+		switch request.Type {
+		case "env":
+			var pair struct{ Name, Value string }
+			ok := ssh.Unmarshal(request.Payload, &pair) == nil
+			if ok {
+				env = append(env, pair.Name+"="+pair.Value)
+			}
+			request.Reply(ok, nil)
+
+		case "pty-req":
+			// the commands run without a terminal, the request is accepted for the clients asking for one
+			request.Reply(true, nil)
+
+		case "subsystem":
+			var subsystem struct{ Name string }
+			if ssh.Unmarshal(request.Payload, &subsystem) != nil || subsystem.Name != "sftp" {
+				request.Reply(false, nil)
+				continue
+			}
+			request.Reply(true, nil)
+			go func() {
+				defer channel.Close()
+				server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.Root))
+				if err != nil {
+					return
+				}
+				server.Serve()
+				server.Close()
+			}()
+
+		case "exec":
+			var command struct{ Command string }
+			if ssh.Unmarshal(request.Payload, &command) != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			cmd := exec.Command("sh", "-c", command.Command)
+			cmd.Dir, cmd.Env = s.Root, append(os.Environ(), env...)
+			cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+			// the children of a signalled shell may keep the output open
+			cmd.WaitDelay = waitDelay
+			stdin, err := cmd.StdinPipe()
+			if err == nil {
+				err = cmd.Start()
+			}
+			request.Reply(err == nil, nil)
+			if err != nil {
+				channel.Close()
+				continue
+			}
+			guard.Lock()
+			process = cmd
+			guard.Unlock()
+
+			go func() {
+				io.Copy(stdin, channel)
+				stdin.Close()
+			}()
+			go func() {
+				status := uint32(0)
+				var exitErr *exec.ExitError
+				if err := cmd.Wait(); errors.As(err, &exitErr) {
+					status = uint32(exitErr.ExitCode())
+					if code, ok := exitErr.Sys().(syscall.WaitStatus); ok && code.Signaled() {
+						status = 128 + uint32(code.Signal())
+					}
+				} else if err != nil {
+					status = 255
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				channel.Close()
+			}()
+
+		case "signal":
+			var signal struct{ Signal string }
+			ssh.Unmarshal(request.Payload, &signal)
+			guard.Lock()
+			if process != nil && process.Process != nil {
+				if sig, found := signals[ssh.Signal(signal.Signal)]; found {
+					process.Process.Signal(sig)
+				}
+			}
+			guard.Unlock()
+			if request.WantReply {
+				request.Reply(true, nil)
+			}
+
+		default:
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// directTCPIP connects the channel to the address the client asked for (local port forwarding).
+func directTCPIP(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	pipe(channel, conn)
+}
+
+// globalRequests serves the remote port forwarding (tcpip-forward) requests of the client.
+func (s *Server) globalRequests(serverConn *ssh.ServerConn, requests <-chan *ssh.Request) {
+	listeners := make(map[string]net.Listener)
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	for request := range requests {
+		var bind struct {
+			Host string
+			Port uint32
+		}
+		switch request.Type {
+		case "tcpip-forward":
+			if ssh.Unmarshal(request.Payload, &bind) != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", fmt.Sprint(bind.Port)))
+			if err != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			port := uint32(listener.Addr().(*net.TCPAddr).Port)
+			listeners[net.JoinHostPort(bind.Host, fmt.Sprint(port))] = listener
+			request.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			go forwardTCPIP(serverConn, listener, bind.Host, port)
+
+		case "cancel-tcpip-forward":
+			if ssh.Unmarshal(request.Payload, &bind) == nil {
+				key := net.JoinHostPort(bind.Host, fmt.Sprint(bind.Port))
+				if listener, found := listeners[key]; found {
+					listener.Close()
+					delete(listeners, key)
+				}
+			}
+			request.Reply(true, nil)
+
+		default:
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func forwardTCPIP(serverConn *ssh.ServerConn, listener net.Listener, host string, port uint32) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		origin := conn.RemoteAddr().(*net.TCPAddr)
+		payload := ssh.Marshal(struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}{host, port, origin.IP.String(), uint32(origin.Port)})
+		go func() {
+			channel, requests, err := serverConn.OpenChannel("forwarded-tcpip", payload)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+			pipe(channel, conn)
+		}()
+	}
+}
+
+func pipe(channel ssh.Channel, conn net.Conn) {
+	defer channel.Close()
+	defer conn.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, channel)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+var signals = map[ssh.Signal]os.Signal{
+	ssh.SIGHUP:  syscall.SIGHUP,
+	ssh.SIGINT:  syscall.SIGINT,
+	ssh.SIGKILL: syscall.SIGKILL,
+	ssh.SIGTERM: syscall.SIGTERM,
+	ssh.SIGQUIT: syscall.SIGQUIT,
+}
+
+// faultyConn delays and/or drops the data coming from the client.
+type faultyConn struct {
+	net.Conn
+	faults   Faults
+	received int64
+}
+
+func (c *faultyConn) Read(p []byte) (int, error) {
+	if c.faults.SlowWrites > 0 {
+		time.Sleep(c.faults.SlowWrites)
+	}
+	if limit := c.faults.DropAfter; limit > 0 {
+		if c.received >= limit {
+			c.Conn.Close()
+			return 0, io.EOF
+		}
+		if rest := limit - c.received; int64(len(p)) > rest {
+			p = p[:rest]
+		}
+	}
+	n, err := c.Conn.Read(p)
+	c.received += int64(n)
+	return n, err
+}
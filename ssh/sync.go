@@ -0,0 +1,366 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SyncUpload = "upload"
+	SyncMkdir  = "mkdir"
+	SyncDelete = "delete"
+
+	checksumBatch = 64 // files per remote sha256sum invocation
+)
+
+type (
+	// SyncOptions control Sync.
+	SyncOptions struct {
+		Checksum bool     // compare SHA-256 (computed remotely with sha256sum) instead of size and mtime
+		Delete   bool     // remove remote files and directories that are not present locally
+		DryRun   bool     // only report what would be done
+		Exclude  []string // glob patterns, matched against the relative path and against the base name
+	}
+
+	// SyncAction is one step of a sync.
+	SyncAction struct {
+		Op     string // SyncUpload, SyncMkdir or SyncDelete
+		Path   string // relative to the synced directories (with forward slashes)
+		Size   int64  // bytes to upload
+		Reason string // why the step is needed, e.g. "missing", "size", "mtime", "checksum"
+	}
+
+	// SyncReport lists what was done (or, in dry-run mode, what would be done).
+	SyncReport struct {
+		Actions []SyncAction
+		Bytes   int64 // total of the uploads
+	}
+)
+
+func (r *SyncReport) String() string {
+	var b strings.Builder
+	for _, action := range r.Actions {
+		fmt.Fprintf(&b, "%-6s %s", action.Op, action.Path)
+		if len(action.Reason) > 0 {
+			fmt.Fprintf(&b, " (%s)", action.Reason)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d action(s), %d byte(s) to upload\n", len(r.Actions), r.Bytes)
+	return b.String()
+}
+
+type syncEntry struct {
+	dir     bool
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// Sync makes the remote directory ("name:path") a copy of the local one, uploading
+// only the files that differ and preserving their modes and modification times.
+func Sync(localDir, remoteDir string, opts SyncOptions) (*SyncReport, error) {
+	dst := ParseAddress(remoteDir)
+	if !dst.Remote() {
+		return nil, fmt.Errorf("incorrect destination: %v (expected name:path)", remoteDir)
+	}
+	var report *SyncReport
+	_, err := withConnection(dst.Name, func(conn *Connection) (err error) {
+		report, err = conn.Sync(localDir, dst.Path, opts)
+		return err
+	})
+	return report, err
+}
+
+// Sync makes the remote directory a copy of the local one (see the package level Sync).
+func (c *Connection) Sync(localDir, remoteDir string, opts SyncOptions) (*SyncReport, error) {
+	local, err := walkLocal(localDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := c.walkRemote(remoteDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := c.planSync(localDir, remoteDir, local, remote, opts)
+	if err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		// the remote directory itself goes first (walkLocal does not list it)
+		mkdir := SyncAction{Op: SyncMkdir, Path: ".", Reason: "missing"}
+		report.Actions = append([]SyncAction{mkdir}, report.Actions...)
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for _, action := range report.Actions {
+		target := path.Join(remoteDir, action.Path)
+		c.printf("sync: %s %s\n", action.Op, target)
+
+		switch action.Op {
+		case SyncMkdir:
+			err = c.MkdirAll(target)
+			if entry, found := local[action.Path]; found && err == nil {
+				err = c.Chmod(target, entry.mode.Perm())
+			}
+		case SyncUpload:
+			entry := local[action.Path]
+			if _, err = c.Upload(filepath.Join(localDir, filepath.FromSlash(action.Path)), target); err == nil {
+				err = c.Chmod(target, entry.mode.Perm())
+			}
+			if err == nil {
+				err = c.Chtimes(target, time.Now(), entry.modTime)
+			}
+		case SyncDelete:
+			err = c.RemoveAll(target)
+		}
+		if err != nil {
+			return report, fmt.Errorf("sync: failed to %s (%s): %w", action.Op, target, err)
+		}
+	}
+	return report, nil
+}
+
+func (c *Connection) planSync(localDir, remoteDir string, local, remote map[string]syncEntry, opts SyncOptions) (*SyncReport, error) {
+	report := &SyncReport{}
+	removed := make(map[string]bool) // remote paths (with everything below them) that go away
+	var candidates []string          // same size files to be compared by checksum
+
+	upload := func(name, reason string) {
+		report.Actions = append(report.Actions, SyncAction{Op: SyncUpload, Path: name, Size: local[name].size, Reason: reason})
+		report.Bytes += local[name].size
+	}
+
+	for _, name := range sortedNames(local) {
+		entry := local[name]
+		existing, found := remote[name]
+		if found && existing.dir != entry.dir {
+			// a file replaced by a directory (or the other way around)
+			report.Actions = append(report.Actions, SyncAction{Op: SyncDelete, Path: name, Reason: "replaced"})
+			removed[name] = true
+			found = false
+		}
+
+		switch {
+		case entry.dir:
+			if !found {
+				report.Actions = append(report.Actions, SyncAction{Op: SyncMkdir, Path: name, Reason: "missing"})
+			}
+		case !found:
+			upload(name, "missing")
+		case existing.size != entry.size:
+			upload(name, "size")
+		case opts.Checksum:
+			candidates = append(candidates, name)
+		case !existing.modTime.Equal(entry.modTime.Truncate(time.Second)):
+			upload(name, "mtime")
+		}
+	}
+
+	if len(candidates) > 0 {
+		remoteSums, err := c.remoteChecksums(remoteDir, candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range candidates {
+			localSum, err := localChecksum(filepath.Join(localDir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, err
+			}
+			if remoteSums[name] != localSum {
+				upload(name, "checksum")
+			}
+		}
+	}
+
+	if opts.Delete {
+		// sorted names put a directory before its content, which goes away with it
+		for _, name := range sortedNames(remote) {
+			if _, found := local[name]; found || underRemoved(name, removed) {
+				continue
+			}
+			report.Actions = append(report.Actions, SyncAction{Op: SyncDelete, Path: name, Reason: "extraneous"})
+			removed[name] = true
+		}
+	}
+	return report, nil
+}
+
+func sortedNames(entries map[string]syncEntry) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func underRemoved(name string, removed map[string]bool) bool {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if removed[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+func excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func walkLocal(root string, exclude []string) (map[string]syncEntry, error) {
+	entries := make(map[string]syncEntry)
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			// sockets, devices, symlinks... are not synced
+			return nil
+		}
+		entries[rel] = syncEntry{dir: info.IsDir(), size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+func (c *Connection) walkRemote(root string, exclude []string) (map[string]syncEntry, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+
+	base := c.remotePath(root)
+	if _, err := client.Stat(base); os.IsNotExist(err) {
+		// nil tells the directory is missing
+		return nil, nil
+	}
+	entries := make(map[string]syncEntry)
+
+	walker := client.Walk(base)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), base), "/")
+		if len(rel) == 0 {
+			continue
+		}
+		if excluded(rel, exclude) {
+			if walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		info := walker.Stat()
+		entries[rel] = syncEntry{dir: info.IsDir(), size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+	}
+	return entries, nil
+}
+
+func localChecksum(name string) (string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remoteChecksums computes SHA-256 of the files (relative to the root) on the remote host.
+func (c *Connection) remoteChecksums(root string, names []string) (map[string]string, error) {
+	base := c.remotePath(root)
+	sums := make(map[string]string, len(names))
+	for start := 0; start < len(names); start += checksumBatch {
+		end := min(start+checksumBatch, len(names))
+
+		var command strings.Builder
+		command.WriteString("cd " + shellQuote(base) + " && sha256sum --")
+		for _, name := range names[start:end] {
+			command.WriteString(" " + shellQuote(name))
+		}
+
+		output, err := c.output(command.String())
+		if err != nil {
+			return nil, fmt.Errorf("sync: remote checksum failed: %w", err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			line := scanner.Text()
+			escaped := strings.HasPrefix(line, "\\")
+			line = strings.TrimPrefix(line, "\\")
+			sum, name, found := strings.Cut(line, "  ")
+			if !found {
+				continue
+			}
+			if escaped {
+				name = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(name)
+			}
+			sums[name] = sum
+		}
+	}
+	return sums, nil
+}
+
+// output runs the command on the remote host and returns its standard output.
+func (c *Connection) output(command string) ([]byte, error) {
+	result, err := c.Run(context.Background(), command)
+	if err != nil {
+		return nil, err
+	}
+	return result.Stdout, nil
+}
+
+// shellQuote quotes the text for a POSIX shell.
+func shellQuote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
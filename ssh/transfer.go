@@ -0,0 +1,316 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	keyResume    = "resume"     // "yes" continues partial uploads
+	keyParallel  = "parallel"   // number of concurrent chunk writers for large files
+	keyChunkSize = "chunk.size" // bytes per concurrently written chunk
+
+	defaultChunkSize = 4 << 20
+	partialPostfix   = ".upload-partial"
+)
+
+// TransferOptions control how a file is uploaded.
+type TransferOptions struct {
+	// Resume continues a previous (failed) upload of the same file from where it stopped,
+	// once the hash of the uploaded prefix is verified against the local file.
+	Resume bool
+
+	// Parallel is the number of chunks written concurrently (0 or 1 for a sequential copy).
+	Parallel int
+
+	// ChunkSize is the size of the chunks written concurrently (4MiB by default).
+	ChunkSize int64
+
+	// Monitor (if set) is called every time the transfer progresses by another percent
+	// (an iox.Monitor can be assigned to it).
+	Monitor func(done int64, percent int, elapsed time.Duration)
+}
+
+// transferOptions returns the options specified for the connection in ssh.info.
+func (c *Connection) transferOptions() TransferOptions {
+	opts := TransferOptions{Resume: c.flag(keyResume)}
+	if parallel, err := strconv.Atoi(c.value(keyParallel)); err == nil {
+		opts.Parallel = parallel
+	}
+	if size, err := strconv.ParseInt(c.value(keyChunkSize), 10, 64); err == nil {
+		opts.ChunkSize = size
+	}
+	return opts
+}
+
+// progress counts the transferred bytes (from several goroutines) and reports them to the monitor.
+type progress struct {
+	guard       sync.Mutex
+	total       int64
+	done        int64
+	lastPercent int
+	startedAt   time.Time
+	monitor     func(done int64, percent int, elapsed time.Duration)
+}
+
+func newProgress(total, done int64, monitor func(int64, int, time.Duration)) *progress {
+	return &progress{total: total, done: done, lastPercent: -1, startedAt: time.Now(), monitor: monitor}
+}
+
+func (p *progress) add(n int64) {
+	if p == nil || p.monitor == nil {
+		return
+	}
+	p.guard.Lock()
+	defer p.guard.Unlock()
+
+	p.done += n
+	percent := 100
+	if p.total > 0 {
+		percent = int(float64(p.done) * 100 / float64(p.total))
+	}
+	if percent > p.lastPercent {
+		p.lastPercent = percent
+		p.monitor(p.done, percent, time.Since(p.startedAt))
+	}
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	reader   io.Reader
+	progress *progress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.progress.add(int64(n))
+	return n, err
+}
+
+// UploadWith copies the local file to the remote path with the given options,
+// returning the number of bytes copied (by this call, i.e. not counting a resumed prefix).
+func (c *Connection) UploadWith(localPath, remotePath string, opts TransferOptions) (int64, error) {
+	srcFile, err := os.Open(localPath)
+	if err != nil {
+		onError("error opening source file (%s): %v", localPath, err)
+		return 0, err
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	var dstFile *remoteWriter
+	var offset int64
+	if opts.Resume {
+		dstFile, offset, err = c.resumeWriter(remotePath, srcFile, size)
+	} else {
+		dstFile, err = c.createWriter(remotePath)
+	}
+	if err != nil {
+		onError("error creating destination file (%s): %v", remotePath, err)
+		return 0, err
+	}
+	if offset > 0 {
+		c.printf("resuming upload of (%s) at %d of %d bytes\n", remotePath, offset, size)
+	}
+
+	tracker := newProgress(size, offset, opts.Monitor)
+	tracker.add(0)
+
+	var copied int64
+	if opts.Parallel > 1 && size-offset > chunkSize(opts) {
+		copied, err = copyChunks(dstFile, srcFile, offset, size, opts, tracker)
+	} else {
+		copied, err = copySequential(dstFile, srcFile, offset, tracker)
+	}
+	if err == nil && offset+copied != size {
+		err = fmt.Errorf("copied %d of %d bytes", offset+copied, size)
+	}
+	if err != nil {
+		if opts.Resume {
+			// keep what made it, the next attempt continues from there
+			dstFile.File.Close()
+		} else {
+			dstFile.abort()
+		}
+		onError("error copying file: %v", err)
+		return copied, err
+	}
+
+	if err = dstFile.commit(size); err != nil {
+		onError("error completing file (%s): %v", remotePath, err)
+	}
+	return copied, err
+}
+
+func chunkSize(opts TransferOptions) int64 {
+	if opts.ChunkSize > 0 {
+		return opts.ChunkSize
+	}
+	return defaultChunkSize
+}
+
+func copySequential(dst *remoteWriter, src *os.File, offset int64, tracker *progress) (int64, error) {
+	if offset > 0 {
+		if _, err := src.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := dst.File.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	if tracker.monitor == nil {
+		// let sftp use its own concurrent writes for a plain file
+		return dst.File.ReadFrom(src)
+	}
+	return dst.File.ReadFrom(&progressReader{reader: src, progress: tracker})
+}
+
+// copyChunks writes the chunks of the file concurrently (each at its own offset).
+func copyChunks(dst *remoteWriter, src *os.File, offset, size int64, opts TransferOptions, tracker *progress) (int64, error) {
+	chunk := chunkSize(opts)
+	offsets := make(chan int64)
+	var (
+		guard    sync.Mutex
+		copied   int64
+		firstErr error
+		workers  sync.WaitGroup
+	)
+
+	fail := func(err error) {
+		guard.Lock()
+		defer guard.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	failed := func() bool {
+		guard.Lock()
+		defer guard.Unlock()
+		return firstErr != nil
+	}
+
+	for i := 0; i < opts.Parallel; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			buffer := make([]byte, chunk)
+			for at := range offsets {
+				n := min(chunk, size-at)
+				read, err := src.ReadAt(buffer[:n], at)
+				if err != nil && !(err == io.EOF && int64(read) == n) {
+					fail(err)
+					continue
+				}
+				written, err := dst.File.WriteAt(buffer[:n], at)
+				guard.Lock()
+				copied += int64(written)
+				guard.Unlock()
+				tracker.add(int64(written))
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	for at := offset; at < size && !failed(); at += chunk {
+		offsets <- at
+	}
+	close(offsets)
+	workers.Wait()
+
+	return copied, firstErr
+}
+
+// resumeWriter opens the partial upload of the file (or starts a new one) and returns
+// the offset to continue from; a partial upload that does not match the local file is discarded.
+func (c *Connection) resumeWriter(dstPath string, src *os.File, size int64) (*remoteWriter, int64, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	writer := &remoteWriter{conn: c, client: client, target: c.remotePath(dstPath)}
+	name := writer.target
+	if c.atomic() {
+		dir, base := path.Split(writer.target)
+		writer.temp = path.Join(dir, tempFilePrefix+base+partialPostfix)
+		name = writer.temp
+	}
+
+	if writer.File, err = client.OpenFile(name, os.O_WRONLY|os.O_CREATE); err != nil {
+		return nil, 0, err
+	}
+	if err := writer.keepMode(); err != nil {
+		writer.File.Close()
+		return nil, 0, err
+	}
+	info, err := writer.File.Stat()
+	if err != nil {
+		writer.File.Close()
+		return nil, 0, err
+	}
+
+	offset := info.Size()
+	if offset > size || (offset > 0 && !c.samePrefix(name, src, offset)) {
+		c.printf("discarding partial upload (%s)\n", name)
+		offset = 0
+	}
+	if offset != info.Size() {
+		if err := writer.File.Truncate(offset); err != nil {
+			writer.File.Close()
+			return nil, 0, err
+		}
+	}
+	return writer, offset, nil
+}
+
+// samePrefix compares the SHA-256 of the first bytes of the local and the remote files.
+// The remote hash is computed on the host (head | sha256sum), or by reading the prefix back.
+func (c *Connection) samePrefix(remoteName string, src *os.File, length int64) bool {
+	localHash := sha256.New()
+	if _, err := io.Copy(localHash, io.NewSectionReader(src, 0, length)); err != nil {
+		return false
+	}
+	want := hex.EncodeToString(localHash.Sum(nil))
+
+	command := fmt.Sprintf("head -c %d -- %s | sha256sum", length, shellQuote(remoteName))
+	if output, err := c.output(command); err == nil {
+		if sum, _, found := bytes.Cut(output, []byte(" ")); found {
+			return string(sum) == want
+		}
+	}
+
+	client, err := c.client()
+	if err != nil {
+		return false
+	}
+	remote, err := client.Open(remoteName)
+	if err != nil {
+		return false
+	}
+	defer remote.Close()
+
+	remoteHash := sha256.New()
+	if copied, err := io.Copy(remoteHash, io.LimitReader(remote, length)); err != nil || copied != length {
+		return false
+	}
+	return hex.EncodeToString(remoteHash.Sum(nil)) == want
+}
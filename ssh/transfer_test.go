@@ -0,0 +1,108 @@
+// Copyright 2017-2025 Seamia Corporation. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssh_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seamia/libs/ssh"
+	"github.com/seamia/libs/ssh/sshtest"
+)
+
+const partialUpload = ".big.bin.upload-partial"
+
+func uploadWith(t *testing.T, name, local, remote string, opts ssh.TransferOptions) (int64, error) {
+	t.Helper()
+	conn, err := ssh.GetConnection(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	return conn.UploadWith(local, remote, opts)
+}
+
+func TestUploadResume(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 1024*1024)
+
+	// the first connection breaks part way, leaving the partial file behind
+	server.SetFaults(sshtest.Faults{DropAfter: 256 * 1024, Connections: 1})
+	if _, err := uploadWith(t, name, local, "big.bin", ssh.TransferOptions{Resume: true}); err == nil {
+		t.Fatal("expected the upload to fail")
+	}
+	ssh.CloseAll()
+	info, err := os.Stat(filepath.Join(server.Root, partialUpload))
+	if err != nil || info.Size() == 0 || info.Size() >= int64(len(data)) {
+		t.Fatalf("unexpected partial upload: %v (%v)", info, err)
+	}
+	partial := info.Size()
+
+	var guard sync.Mutex
+	first := int64(-1)
+	monitor := func(done int64, percent int, elapsed time.Duration) {
+		guard.Lock()
+		defer guard.Unlock()
+		if first < 0 {
+			first = done
+		}
+	}
+	copied, err := uploadWith(t, name, local, "big.bin", ssh.TransferOptions{Resume: true, Monitor: monitor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != int64(len(data))-partial || first != partial {
+		t.Fatalf("the upload was not resumed: copied %d, started at %d, partial %d", copied, first, partial)
+	}
+	if uploaded, _ := os.ReadFile(filepath.Join(server.Root, "big.bin")); !bytes.Equal(uploaded, data) {
+		t.Fatal("resumed upload differs")
+	}
+	if _, err := os.Stat(filepath.Join(server.Root, partialUpload)); !os.IsNotExist(err) {
+		t.Fatal("the partial file was left behind")
+	}
+}
+
+func TestUploadResumeMismatch(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 256*1024)
+
+	// a partial upload of some other file
+	if err := os.WriteFile(filepath.Join(server.Root, partialUpload), bytes.Repeat([]byte("x"), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := uploadWith(t, name, local, "big.bin", ssh.TransferOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != int64(len(data)) {
+		t.Fatalf("the mismatching partial file was resumed: copied %d of %d", copied, len(data))
+	}
+	if uploaded, _ := os.ReadFile(filepath.Join(server.Root, "big.bin")); !bytes.Equal(uploaded, data) {
+		t.Fatal("uploaded file differs")
+	}
+}
+
+func TestUploadParallel(t *testing.T) {
+	server := sshtest.NewServer(t, sshtest.Options{})
+	name := register(t, server, nil)
+	local, data := localFile(t, 1024*1024)
+
+	copied, err := uploadWith(t, name, local, "parallel.bin", ssh.TransferOptions{Parallel: 4, ChunkSize: 64 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != int64(len(data)) {
+		t.Fatalf("copied %d of %d", copied, len(data))
+	}
+	if uploaded, _ := os.ReadFile(filepath.Join(server.Root, "parallel.bin")); !bytes.Equal(uploaded, data) {
+		t.Fatal("uploaded file differs")
+	}
+}
@@ -5,6 +5,10 @@
 package ssh
 
 import (
+	"net"
+	"sync"
+	"time"
+
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
@@ -12,7 +16,15 @@ import (
 type Dict map[string]string
 
 type Connection struct {
-	Info       Dict
+	Info Dict
+
+	guard      sync.Mutex // guards the fields below
 	sshClient  *ssh.Client
 	sftpClient *sftp.Client
+	agentConn  net.Conn      // connection to ssh-agent (if used for auth)
+	via        *Connection   // jump host the connection goes through
+	stop       chan struct{} // stops the keepalive/idle loop
+	dead       bool          // the underlying connection went away
+	users      int           // number of the operations/callers using the connection
+	lastUsed   time.Time
 }
@@ -13,6 +13,9 @@ type (
 	WriteDeadline interface {
 		SetWriteDeadline(t time.Time) error
 	}
+	ReadDeadline interface {
+		SetReadDeadline(t time.Time) error
+	}
 	BinaryPacket struct {
 		Header Msi
 		Blob   []byte